@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"models"
+)
+
+const bundleChecksumsFile = "SHA256SUMS"
+
+// writeBundle writes the install script, every file in args.Certs and, when
+// msiDir is set, both MSIs to a zip at bundlePath. The last entry is
+// SHA256SUMS, listing the checksum of every other entry in the format read
+// by sha256sum -c. When there are recipients the zip is encrypted to them.
+func writeBundle(bundlePath, msiDir, format string, args *models.InstallerArguments, recipients []bundleRecipient) error {
+	file, err := createFile(bundlePath, privateFileMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	plaintext := new(bytes.Buffer)
+	if len(recipients) > 0 {
+		w = plaintext
+	}
+	bundle := &bundleWriter{zip: zip.NewWriter(w)}
+
+	err = bundle.addFile("install."+format, renderInstallScript(format, args), privateFileMode)
+	if err != nil {
+		return err
+	}
+
+	filenames := []string{}
+	for filename := range args.Certs {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		cert := args.Certs[filename]
+		var perm os.FileMode = 0644
+		if cert.IsSecret() {
+			perm = privateFileMode
+		}
+		err = bundle.addFile(filename, []byte(cert.Contents), perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	if msiDir != "" {
+		for _, msi := range []string{diegoMsi, gardenMsi} {
+			err = bundle.copyFile(msi, filepath.Join(msiDir, msi))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = bundle.writeChecksums()
+	if err != nil {
+		return err
+	}
+	err = bundle.zip.Close()
+	if err != nil {
+		return err
+	}
+	if len(recipients) > 0 {
+		err = encryptBundle(file, plaintext.Bytes(), recipients)
+		if err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
+type bundleWriter struct {
+	zip       *zip.Writer
+	checksums []string
+}
+
+func (b *bundleWriter) create(name string, perm os.FileMode) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	header.SetMode(perm)
+	return b.zip.CreateHeader(header)
+}
+
+func (b *bundleWriter) addFile(name string, contents []byte, perm os.FileMode) error {
+	w, err := b.create(name, perm)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	if err != nil {
+		return err
+	}
+	b.addChecksum(name, sha256.Sum256(contents))
+	return nil
+}
+
+func (b *bundleWriter) copyFile(name, source string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	w, err := b.create(name, 0644)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(w, hash), in)
+	if err != nil {
+		return fmt.Errorf("copying %s: %s", source, err)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	b.addChecksum(name, sum)
+	return nil
+}
+
+func (b *bundleWriter) addChecksum(name string, sum [sha256.Size]byte) {
+	b.checksums = append(b.checksums, fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name))
+}
+
+func (b *bundleWriter) writeChecksums() error {
+	w, err := b.create(bundleChecksumsFile, 0644)
+	if err != nil {
+		return err
+	}
+	for _, line := range b.checksums {
+		_, err = io.WriteString(w, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
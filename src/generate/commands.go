@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"yaml"
+
+	"models"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(arguments []string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"generate", "Write the install script and certs for a Windows cell", runGenerate},
+		{"validate", "Check that a manifest has everything a Windows cell needs, without writing anything", runValidate},
+		{"inspect", "Print each installer value and the part of the manifest it came from", runInspect},
+		{"list-deployments", "List the BOSH director's deployments and their releases", runListDeployments},
+		{"keygen", "Create a key pair for encrypting bundles", runKeygen},
+		{"decrypt", "Decrypt a bundle written with -encryptTo or -passphraseFile", runDecrypt},
+	}
+}
+
+func main() {
+	arguments := os.Args[1:]
+	if len(arguments) == 0 {
+		usage()
+	}
+	// flags without a command are passed to generate, as they were before
+	// there were commands
+	if strings.HasPrefix(arguments[0], "-") {
+		runGenerate(arguments)
+		return
+	}
+
+	for _, c := range commands {
+		if c.name == arguments[0] {
+			c.run(arguments[1:])
+			return
+		}
+	}
+	if arguments[0] == "help" {
+		printCommands()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: unknown command %s\n", arguments[0])
+	usage()
+}
+
+func usage() {
+	printCommands()
+	os.Exit(1)
+}
+
+func printCommands() {
+	fmt.Fprintf(os.Stderr, "Usage of generate:\n  generate COMMAND [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s%s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun generate COMMAND -h for the flags of a command.\n")
+}
+
+// newFlagSet returns the flag set for a command. Its Usage prints the
+// command's flags, so it can be used by usageError.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of generate %s:\n", name)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// usageError prints an error and the command's flags, then exits.
+func usageError(flags *flag.FlagSet, format string, a ...interface{}) {
+	if format != "" {
+		fmt.Fprintf(os.Stderr, "Error: "+format+"\n", a...)
+	}
+	flags.Usage()
+	os.Exit(1)
+}
+
+// boshFlags are the flags every command that talks to the director accepts.
+type boshFlags struct {
+	config       string
+	url          string
+	caCert       string
+	client       string
+	clientSecret string
+	deployment   string
+	insecure     bool
+}
+
+func (f *boshFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.config, "config", "", "(optional) Path to a YAML file with the environment, client, client_secret, ca_cert, deployment and insecure settings of the Bosh director")
+	flags.StringVar(&f.url, "boshUrl", "", "(optional) Bosh director URL e.g. https://bosh.example:25555, defaults to $BOSH_ENVIRONMENT")
+	flags.StringVar(&f.caCert, "boshCACert", "", "(optional) Path to a PEM bundle used to verify the Bosh director and UAA certificates, defaults to $BOSH_CA_CERT")
+	flags.StringVar(&f.client, "boshClient", "", "(optional) Client id used to authenticate with the Bosh director, defaults to $BOSH_CLIENT")
+	flags.StringVar(&f.clientSecret, "boshClientSecret", "", "(optional) Client secret used to authenticate with the Bosh director, defaults to $BOSH_CLIENT_SECRET")
+	flags.StringVar(&f.deployment, "deployment", "", "(optional) Name of the Bosh deployment containing the Diego cells, defaults to $BOSH_DEPLOYMENT")
+	flags.BoolVar(&f.insecure, "insecure", false, "(optional) Skip TLS certificate verification of the Bosh director and UAA")
+}
+
+// resolve fills in the settings that were not given as flags from the
+// environment and then from the -config file.
+func (f *boshFlags) resolve(flags *flag.FlagSet) {
+	config, err := loadBoshConfig(f.config)
+	if err != nil {
+		Fatal(err)
+	}
+
+	f.url = firstSet(f.url, "BOSH_ENVIRONMENT", config.Environment)
+	f.caCert = firstSet(f.caCert, "BOSH_CA_CERT", config.CACert)
+	f.client = firstSet(f.client, "BOSH_CLIENT", config.Client)
+	f.clientSecret = firstSet(f.clientSecret, "BOSH_CLIENT_SECRET", config.ClientSecret)
+	f.deployment = firstSet(f.deployment, "BOSH_DEPLOYMENT", config.Deployment)
+
+	insecureSet := false
+	flags.Visit(func(fl *flag.Flag) {
+		insecureSet = insecureSet || fl.Name == "insecure"
+	})
+	if !insecureSet {
+		f.insecure = config.Insecure
+	}
+}
+
+func (f *boshFlags) connect() *Bosh {
+	u, err := directorURL(f.url)
+	if err != nil {
+		Fatal(err)
+	}
+	if u.User != nil {
+		fmt.Fprintln(os.Stderr, "Warning: credentials in the director URL end up in shell history, use BOSH_CLIENT and BOSH_CLIENT_SECRET or -config instead")
+	}
+
+	httpClient, err := newHTTPClient(f.caCert, f.insecure)
+	if err != nil {
+		Fatal(err)
+	}
+
+	bosh := NewBosh(*u, httpClient, f.client, f.clientSecret)
+	bosh.Authorize()
+	return bosh
+}
+
+// deployments returns the director's deployments, exiting if the director
+// does not return them.
+func (b *Bosh) deployments() []models.IndexDeployment {
+	response := b.MakeRequest("/deployments")
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		buf := new(bytes.Buffer)
+		_, err := buf.ReadFrom(response.Body)
+		if err != nil {
+			fmt.Printf("Could not read response from BOSH director.")
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Unexpected BOSH director response: %v, %v", response.StatusCode, buf.String())
+		os.Exit(1)
+	}
+
+	deployments := []models.IndexDeployment{}
+	json.NewDecoder(response.Body).Decode(&deployments)
+	return deployments
+}
+
+// fetchManifest downloads the manifest of -deployment or, when it is not
+// given, of the only deployment containing cf and diego.
+func (f *boshFlags) fetchManifest() []byte {
+	bosh := f.connect()
+	deployments := bosh.deployments()
+
+	var idx int
+	if f.deployment != "" {
+		idx = FindDeployment(deployments, f.deployment)
+		if idx == -1 {
+			fmt.Fprintf(os.Stderr, "BOSH Director does not have a deployment named %s. Available deployments:\n", f.deployment)
+			printDeployments(deployments)
+			os.Exit(1)
+		}
+	} else {
+		idx = GetDiegoDeployment(deployments)
+		if idx == -1 {
+			fmt.Fprintf(os.Stderr, "BOSH Director does not have exactly one deployment containing a cf and diego release.\n")
+			candidates := DiegoDeploymentCandidates(deployments)
+			if len(candidates) == 0 {
+				candidates = deployments
+			}
+			fmt.Fprintln(os.Stderr, "Use -deployment to select one of:")
+			printDeployments(candidates)
+			os.Exit(1)
+		}
+	}
+
+	response := bosh.MakeRequest("/deployments/" + deployments[idx].Name)
+	defer response.Body.Close()
+
+	deployment := models.ShowDeployment{}
+	json.NewDecoder(response.Body).Decode(&deployment)
+	return []byte(deployment.Manifest)
+}
+
+// manifestFlags are the flags of every command that reads a manifest, either
+// from a file or from the director.
+type manifestFlags struct {
+	bosh          boshFlags
+	manifest      string
+	instanceGroup string
+	varsStore     string
+	varsFiles     stringSlice
+	vars          stringSlice
+	opsFiles      stringSlice
+}
+
+func (f *manifestFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.manifest, "manifest", "", "Path to CF manifest file")
+	f.bosh.register(flags)
+	flags.StringVar(&f.instanceGroup, "instanceGroup", "", "(optional) Name of the job or instance group of the Windows cell, required when the manifest has several cell groups and none is recognisably Windows")
+	flags.StringVar(&f.varsStore, "vars-store", "", "(optional) Path to a YAML file of variables used to resolve ((placeholders)) in the manifest")
+	flags.Var(&f.varsFiles, "vars-file", "(optional) Path to a YAML file of variables, may be repeated and overrides -vars-store")
+	flags.Var(&f.vars, "var", "(optional) Variable given as key=value, may be repeated and overrides -vars-file")
+	flags.Var(&f.opsFiles, "ops-file", "(optional) Path to a BOSH ops file applied to the manifest, may be repeated")
+}
+
+// check exits unless exactly one of -manifest and -boshUrl was given. The
+// director may also come from BOSH_ENVIRONMENT or -config, which are
+// ignored when -manifest is given.
+func (f *manifestFlags) check(flags *flag.FlagSet) {
+	if f.bosh.url != "" && f.manifest != "" {
+		usageError(flags, "only boshServerUrl or cfManifest may be specified")
+	}
+	if f.manifest != "" {
+		return
+	}
+	f.bosh.resolve(flags)
+	if f.bosh.url == "" {
+		usageError(flags, "")
+	}
+}
+
+// load reads the manifest, applies the ops files and variables and fills in
+// the installer arguments. Missing properties, empty certificates and
+// unresolved variables are reported and the command exits.
+func (f *manifestFlags) load() *models.InstallerArguments {
+	var manifestContents []byte
+	if f.manifest != "" {
+		var err error
+		manifestContents, err = ioutil.ReadFile(f.manifest)
+		if err != nil {
+			Fatal(err)
+		}
+	} else {
+		manifestContents = f.bosh.fetchManifest()
+	}
+
+	for _, opsFile := range f.opsFiles {
+		ops, err := ioutil.ReadFile(opsFile)
+		if err != nil {
+			Fatal(err)
+		}
+		manifestContents, err = yaml.ApplyOps(manifestContents, ops)
+		if err != nil {
+			Fatal(fmt.Errorf("applying %s: %s", opsFile, err))
+		}
+	}
+
+	manifestVars, err := loadVars(f.varsStore, f.varsFiles, f.vars)
+	if err != nil {
+		Fatal(err)
+	}
+	manifestContents, err = yaml.Interpolate(manifestContents, manifestVars)
+	if e, ok := err.(yaml.ErrUnresolvedVariables); ok {
+		fmt.Fprintln(os.Stderr, "Error: the manifest contains the following unresolved variables:")
+		for _, name := range e.Names {
+			fmt.Fprintf(os.Stderr, "  %s\n", name)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		Fatal(err)
+	}
+
+	var manifest models.Manifest
+	err = yaml.Unmarshal(manifestContents, &manifest)
+	if err != nil {
+		Fatal(err)
+	}
+
+	args, err := models.NewInstallerArguments(&manifest, f.instanceGroup)
+	if e, ok := err.(models.ErrRepJob); ok && len(e.RepJobs) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", e)
+		fmt.Fprintln(os.Stderr, "Use -instanceGroup to select one of:")
+		for _, name := range e.RepJobs {
+			fmt.Fprintf(os.Stderr, "  %s\n", name)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		Fatal(err)
+	}
+
+	missing := fillInstallerArguments(args)
+	if len(missing) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: the manifest is missing the following properties:")
+		for _, path := range missing {
+			fmt.Fprintf(os.Stderr, "  %s\n", path)
+		}
+		os.Exit(1)
+	}
+
+	empty := models.EmptyCerts(args.Certs)
+	for _, problem := range empty {
+		fmt.Fprintf(os.Stderr, "Error: %s (read from %s)\n", problem, args.Certs[problem.Filename].Source)
+	}
+	if len(empty) > 0 {
+		os.Exit(1)
+	}
+	return args
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"yaml"
+)
+
+const defaultDirectorPort = "25555"
+
+// boshConfig is the -config file. Every setting may also be given as a flag
+// or with the environment variable used by the bosh CLI, which take
+// precedence in that order.
+type boshConfig struct {
+	Environment  string `yaml:"environment"`
+	Client       string `yaml:"client"`
+	ClientSecret string `yaml:"client_secret"`
+	CACert       string `yaml:"ca_cert"`
+	Deployment   string `yaml:"deployment"`
+	Insecure     bool   `yaml:"insecure"`
+}
+
+func loadBoshConfig(filename string) (boshConfig, error) {
+	config := boshConfig{}
+	if filename == "" {
+		return config, nil
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+	err = yaml.Unmarshal(contents, &config)
+	if err != nil {
+		return config, fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	return config, nil
+}
+
+// firstSet returns the flag value if it was given, then the environment
+// variable, then the config file setting.
+func firstSet(flagValue, envVar, configValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if value := os.Getenv(envVar); value != "" {
+		return value
+	}
+	return configValue
+}
+
+// directorURL accepts a director given as a URL or, like BOSH_ENVIRONMENT,
+// as a host with an optional port, which is assumed to use https on port
+// 25555.
+func directorURL(environment string) (*url.URL, error) {
+	if !strings.Contains(environment, "://") {
+		if _, _, err := net.SplitHostPort(environment); err != nil {
+			environment = net.JoinHostPort(strings.Trim(environment, "[]"), defaultDirectorPort)
+		}
+		environment = "https://" + environment
+	}
+
+	u, err := url.Parse(environment)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BOSH director %q: %s", environment, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid BOSH director %q: no host", environment)
+	}
+	return u, nil
+}
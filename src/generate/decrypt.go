@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runDecrypt implements generate decrypt, which turns a bundle written with
+// -encryptTo or -passphraseFile back into a zip.
+func runDecrypt(arguments []string) {
+	var (
+		in             string
+		out            string
+		identities     stringSlice
+		passphraseFile string
+	)
+	flags := newFlagSet("decrypt")
+	flags.StringVar(&in, "in", "", "Path to the encrypted bundle")
+	flags.StringVar(&out, "out", "", "Path to write the decrypted zip to")
+	flags.Var(&identities, "identity", "(optional) Path to a private key written by generate keygen, may be repeated")
+	flags.StringVar(&passphraseFile, "passphraseFile", "", "(optional) Path to a file containing the bundle passphrase")
+	flags.Parse(arguments)
+
+	if in == "" || out == "" || (len(identities) == 0 && passphraseFile == "") {
+		usageError(flags, "")
+	}
+
+	keys := []bundleIdentity{}
+	for _, identity := range identities {
+		key, err := loadIdentity(identity)
+		if err != nil {
+			Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	if passphraseFile != "" {
+		key, err := readPassphrase(passphraseFile)
+		if err != nil {
+			Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	file, err := os.Open(in)
+	if err != nil {
+		Fatal(err)
+	}
+	defer file.Close()
+
+	plaintext, err := decryptBundle(file, keys)
+	if err != nil {
+		Fatal(fmt.Errorf("decrypting %s: %s", in, err))
+	}
+
+	err = writeFile(out, plaintext, privateFileMode)
+	if err != nil {
+		Fatal(err)
+	}
+}
+
+// runKeygen implements generate keygen, which writes a private key for
+// generate decrypt and prints the public key to pass to -encryptTo.
+func runKeygen(arguments []string) {
+	var out string
+	flags := newFlagSet("keygen")
+	flags.StringVar(&out, "out", "", "Path to write the private key to")
+	flags.Parse(arguments)
+
+	if out == "" {
+		usageError(flags, "")
+	}
+
+	privatePEM, publicPEM, err := generateIdentity()
+	if err != nil {
+		Fatal(err)
+	}
+	file, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, privateFileMode)
+	if err != nil {
+		Fatal(err)
+	}
+	defer file.Close()
+	_, err = file.Write(privatePEM)
+	if err != nil {
+		Fatal(err)
+	}
+	os.Stdout.Write(publicPEM)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"models"
+)
+
+const redacted = "<redacted>"
+
+// printDryRun writes the install script and a summary of the cert files that
+// would be generated. Secrets are redacted unless showSecrets is set.
+func printDryRun(w io.Writer, format string, args *models.InstallerArguments, showSecrets bool) {
+	scriptArgs := *args
+	if !showSecrets {
+		scriptArgs.SharedSecret = redacted
+	}
+
+	fmt.Fprintf(w, "==> install.%s <==\n", format)
+	w.Write(renderInstallScript(format, &scriptArgs))
+	fmt.Fprint(w, "\n\n")
+
+	filenames := []string{}
+	for filename := range args.Certs {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	fmt.Fprintf(w, "Stack: %s\nZone: %s\n\n", args.Stack, args.Zone)
+
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSUBJECT\tEXPIRES")
+	for _, filename := range filenames {
+		cert := args.Certs[filename]
+		if cert.IsSecret() {
+			fmt.Fprintf(table, "%s\t%s\t\n", filename, redacted)
+			continue
+		}
+
+		x509Certs, err := cert.Certificates()
+		if err != nil {
+			fmt.Fprintf(table, "%s\t(%s)\t\n", filename, err)
+			continue
+		}
+		for _, x509Cert := range x509Certs {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", filename, x509Cert.Subject.CommonName, x509Cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	table.Flush()
+
+	if showSecrets {
+		for _, filename := range filenames {
+			if args.Certs[filename].IsSecret() {
+				fmt.Fprintf(w, "\n==> %s <==\n%s\n", filename, args.Certs[filename].Contents)
+			}
+		}
+	}
+}
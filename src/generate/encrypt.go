@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// An encrypted bundle is encryptedBundleMagic, a JSON bundleHeader on a
+// single line and the zip sealed with AES-256-GCM under a random file key.
+// The header holds a copy of the file key for each recipient, wrapped either
+// to an X25519 public key or to a key derived from a passphrase with scrypt.
+const (
+	encryptedBundleMagic = "greenhouse-encrypted-bundle/v1\n"
+
+	x25519KeyType  = "x25519"
+	scryptKeyType  = "scrypt"
+	publicKeyType  = "GREENHOUSE BUNDLE PUBLIC KEY"
+	privateKeyType = "GREENHOUSE BUNDLE PRIVATE KEY"
+
+	scryptLogN = 15
+	// maxBundleKeys bounds the work decryptBundle does for a crafted header.
+	maxBundleKeys = 64
+)
+
+type bundleHeader struct {
+	Keys []wrappedKey `json:"keys"`
+}
+
+type wrappedKey struct {
+	Type string `json:"type"`
+	// Ephemeral is the sender's X25519 public key for x25519 keys.
+	Ephemeral []byte `json:"ephemeral,omitempty"`
+	// Salt and LogN are the scrypt parameters for passphrase keys.
+	Salt []byte `json:"salt,omitempty"`
+	LogN int    `json:"log_n,omitempty"`
+	// Key is the nonce followed by the sealed file key.
+	Key []byte `json:"key"`
+}
+
+// A bundleRecipient wraps the file key of a bundle so that only the
+// matching bundleIdentity can unwrap it.
+type bundleRecipient interface {
+	wrap(fileKey []byte) (wrappedKey, error)
+}
+
+// A bundleIdentity unwraps file keys. unwrap returns false when key was not
+// wrapped for this identity.
+type bundleIdentity interface {
+	unwrap(key wrappedKey) ([]byte, bool)
+}
+
+type x25519Recipient struct {
+	publicKey []byte
+}
+
+type x25519Identity struct {
+	privateKey []byte
+	publicKey  []byte
+}
+
+type passphraseKey struct {
+	passphrase []byte
+}
+
+func (r x25519Recipient) wrap(fileKey []byte) (wrappedKey, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	_, err := rand.Read(ephemeral)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	ephemeralPublic, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	shared, err := curve25519.X25519(ephemeral, r.publicKey)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+
+	wrapKey, err := x25519WrapKey(shared, ephemeralPublic, r.publicKey)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	sealed, err := seal(wrapKey, fileKey, nil)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	return wrappedKey{Type: x25519KeyType, Ephemeral: ephemeralPublic, Key: sealed}, nil
+}
+
+func (i x25519Identity) unwrap(key wrappedKey) ([]byte, bool) {
+	if key.Type != x25519KeyType {
+		return nil, false
+	}
+	shared, err := curve25519.X25519(i.privateKey, key.Ephemeral)
+	if err != nil {
+		return nil, false
+	}
+	wrapKey, err := x25519WrapKey(shared, key.Ephemeral, i.publicKey)
+	if err != nil {
+		return nil, false
+	}
+	fileKey, err := open(wrapKey, key.Key, nil)
+	return fileKey, err == nil
+}
+
+func x25519WrapKey(shared, ephemeralPublic, recipientPublic []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeralPublic...), recipientPublic...)
+	wrapKey := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(x25519KeyType)), wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return wrapKey, nil
+}
+
+func (p passphraseKey) wrap(fileKey []byte) (wrappedKey, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	wrapKey, err := scrypt.Key(p.passphrase, salt, 1<<scryptLogN, 8, 1, 32)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	sealed, err := seal(wrapKey, fileKey, nil)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	return wrappedKey{Type: scryptKeyType, Salt: salt, LogN: scryptLogN, Key: sealed}, nil
+}
+
+func (p passphraseKey) unwrap(key wrappedKey) ([]byte, bool) {
+	// bound the work factor so a crafted header cannot exhaust memory
+	if key.Type != scryptKeyType || key.LogN < 1 || key.LogN > 20 {
+		return nil, false
+	}
+	wrapKey, err := scrypt.Key(p.passphrase, key.Salt, 1<<uint(key.LogN), 8, 1, 32)
+	if err != nil {
+		return nil, false
+	}
+	fileKey, err := open(wrapKey, key.Key, nil)
+	return fileKey, err == nil
+}
+
+// encryptBundle writes plaintext to w, encrypted to every recipient.
+func encryptBundle(w io.Writer, plaintext []byte, recipients []bundleRecipient) error {
+	fileKey := make([]byte, 32)
+	_, err := rand.Read(fileKey)
+	if err != nil {
+		return err
+	}
+
+	header := bundleHeader{Keys: []wrappedKey{}}
+	for _, recipient := range recipients {
+		key, err := recipient.wrap(fileKey)
+		if err != nil {
+			return err
+		}
+		header.Keys = append(header.Keys, key)
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	preamble := append([]byte(encryptedBundleMagic), headerJSON...)
+	preamble = append(preamble, '\n')
+
+	sealed, err := seal(fileKey, plaintext, preamble)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(preamble)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(sealed)
+	return err
+}
+
+// decryptBundle reverses encryptBundle using the first identity that can
+// unwrap the file key.
+func decryptBundle(r io.Reader, identities []bundleIdentity) ([]byte, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.ReadString('\n')
+	if err != nil || magic != encryptedBundleMagic {
+		return nil, errors.New("not an encrypted bundle")
+	}
+	headerJSON, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle header: %s", err)
+	}
+	var header bundleHeader
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bundle header: %s", err)
+	}
+	err = checkBundleKeys(header.Keys)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range header.Keys {
+		for _, identity := range identities {
+			fileKey, ok := identity.unwrap(key)
+			if !ok {
+				continue
+			}
+			preamble := append([]byte(magic), headerJSON...)
+			plaintext, err := open(fileKey, sealed, preamble)
+			if err != nil {
+				return nil, errors.New("the bundle has been modified or is corrupt")
+			}
+			return plaintext, nil
+		}
+	}
+	return nil, errors.New("none of the given keys or passphrases can decrypt the bundle")
+}
+
+// checkBundleKeys rejects headers that could make decryptBundle run scrypt
+// many times: a passphrase bundle has a single scrypt key and nothing else.
+func checkBundleKeys(keys []wrappedKey) error {
+	if len(keys) > maxBundleKeys {
+		return fmt.Errorf("the bundle header has %d keys, at most %d are allowed", len(keys), maxBundleKeys)
+	}
+	for _, key := range keys {
+		if key.Type == scryptKeyType && len(keys) > 1 {
+			return errors.New("the bundle header has a passphrase key alongside other keys")
+		}
+	}
+	return nil
+}
+
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// generateIdentity returns a new X25519 key pair, PEM encoded.
+func generateIdentity() (privatePEM, publicPEM []byte, err error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+	_, err = rand.Read(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	privatePEM = pem.EncodeToMemory(&pem.Block{Type: privateKeyType, Bytes: privateKey})
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: publicKeyType, Bytes: publicKey})
+	return privatePEM, publicPEM, nil
+}
+
+// loadRecipient reads a public key written by generate keygen. As with
+// -boshCACert, key may be either a path or the PEM contents.
+func loadRecipient(key string) (bundleRecipient, error) {
+	keyBytes, err := readKey(key, publicKeyType)
+	if err != nil {
+		return nil, err
+	}
+	return x25519Recipient{publicKey: keyBytes}, nil
+}
+
+func loadIdentity(key string) (bundleIdentity, error) {
+	privateKey, err := readKey(key, privateKeyType)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return x25519Identity{privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+func readKey(key, blockType string) ([]byte, error) {
+	contents := []byte(key)
+	if !strings.Contains(key, "-----BEGIN") {
+		var err error
+		contents, err = ioutil.ReadFile(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("no %s found in %s", blockType, key)
+	}
+	if len(block.Bytes) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("%s in %s has the wrong length", blockType, key)
+	}
+	return block.Bytes, nil
+}
+
+// readPassphrase returns the first line of passphraseFile.
+func readPassphrase(passphraseFile string) (passphraseKey, error) {
+	contents, err := ioutil.ReadFile(passphraseFile)
+	if err != nil {
+		return passphraseKey{}, err
+	}
+	passphrase := bytes.TrimRight(bytes.SplitN(contents, []byte("\n"), 2)[0], "\r")
+	if len(passphrase) == 0 {
+		return passphraseKey{}, fmt.Errorf("%s does not contain a passphrase", passphraseFile)
+	}
+	return passphraseKey{passphrase: passphrase}, nil
+}
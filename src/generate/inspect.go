@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"models"
+)
+
+// secretFields are the InstallerArguments fields inspect redacts unless
+// -show-secrets is given.
+var secretFields = map[string]bool{
+	"SharedSecret": true,
+	"Password":     true,
+}
+
+func runValidate(arguments []string) {
+	var (
+		source        manifestFlags
+		expiryWarning time.Duration
+	)
+	flags := newFlagSet("validate")
+	source.register(flags)
+	flags.DurationVar(&expiryWarning, "certExpiryWarning", 30*24*time.Hour, "(optional) Warn about certificates expiring within this duration")
+	flags.Parse(arguments)
+	source.check(flags)
+
+	args := source.load()
+	if !checkCerts(args, expiryWarning) {
+		os.Exit(1)
+	}
+	fmt.Println("Manifest is valid")
+}
+
+func runInspect(arguments []string) {
+	var (
+		source      manifestFlags
+		showSecrets bool
+		zone        string
+		stack       string
+	)
+	flags := newFlagSet("inspect")
+	source.register(flags)
+	flags.StringVar(&zone, "zone", "", "(optional) Redundancy zone of the cell, as given to generate")
+	flags.StringVar(&stack, "stack", "", "(optional) Stack of the cell, as given to generate")
+	flags.BoolVar(&showSecrets, "show-secrets", false, "(optional) Include secrets in the output")
+	flags.Parse(arguments)
+	source.check(flags)
+	if stack != "" && !models.IsKnownStack(stack) {
+		usageError(flags, "unknown stack %s, expected one of %s", stack, strings.Join(models.KnownStacks, ", "))
+	}
+
+	args := source.load()
+	applyOverrides(args, zone, stack)
+	printSources(os.Stdout, args, showSecrets)
+}
+
+// printSources writes a table of every field a Fill* method set, with its
+// value and where in the manifest it came from, followed by a table of the
+// cert files and their sources.
+func printSources(w io.Writer, args *models.InstallerArguments, showSecrets bool) {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "FIELD\tVALUE\tSOURCE")
+
+	value := reflect.ValueOf(args).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		source, ok := args.Sources[name]
+		if !ok {
+			continue
+		}
+		fieldValue := fmt.Sprint(value.Field(i).Interface())
+		if secretFields[name] && !showSecrets {
+			fieldValue = redacted
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", name, fieldValue, source)
+	}
+	table.Flush()
+
+	filenames := []string{}
+	for filename := range args.Certs {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	fmt.Fprintln(w)
+	table = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSOURCE")
+	for _, filename := range filenames {
+		fmt.Fprintf(table, "%s\t%s\n", filename, args.Certs[filename].Source)
+	}
+	table.Flush()
+}
+
+func runListDeployments(arguments []string) {
+	var bosh boshFlags
+	flags := newFlagSet("list-deployments")
+	bosh.register(flags)
+	flags.Parse(arguments)
+	bosh.resolve(flags)
+	if bosh.url == "" {
+		usageError(flags, "")
+	}
+
+	deployments := bosh.connect().deployments()
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tRELEASES\tDIEGO")
+	for _, deployment := range deployments {
+		releases := []string{}
+		for _, rel := range deployment.Releases {
+			releases = append(releases, rel.Name+"/"+rel.Version)
+		}
+		diego := ""
+		if isDiegoDeployment(deployment) {
+			diego = "yes"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", deployment.Name, strings.Join(releases, ", "), diego)
+	}
+	table.Flush()
+}
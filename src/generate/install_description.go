@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"yaml"
+
+	"models"
+)
+
+// installDescriptionVersion is bumped whenever a field of
+// installDescription is renamed or removed.
+const installDescriptionVersion = 1
+
+// installDescription is the -format json and -format yaml output, for
+// tools that install the MSIs themselves instead of running install.bat.
+type installDescription struct {
+	Version int               `json:"version" yaml:"version"`
+	Msis    []msiDescription  `json:"msis" yaml:"msis"`
+	Files   []fileDescription `json:"files" yaml:"files"`
+	// Sources maps the name of each InstallerArguments field read from the
+	// manifest to where it was read from.
+	Sources map[string]sourceDescription `json:"sources" yaml:"sources"`
+}
+
+type msiDescription struct {
+	Name string `json:"name" yaml:"name"`
+	// Properties maps each msiexec property to its value. File properties
+	// hold a path relative to the description.
+	Properties map[string]string `json:"properties" yaml:"properties"`
+}
+
+type fileDescription struct {
+	Path   string            `json:"path" yaml:"path"`
+	Kind   string            `json:"kind" yaml:"kind"`
+	Source sourceDescription `json:"source" yaml:"source"`
+}
+
+type sourceDescription struct {
+	// Block is the job, instance group or global properties the value was
+	// read from, or "default".
+	Block string `json:"block" yaml:"block"`
+	// Path is the ops file path of the property in the manifest.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+var certKindNames = map[models.CertKind]string{
+	models.CACert:      "ca_cert",
+	models.Certificate: "certificate",
+	models.PrivateKey:  "private_key",
+	models.Secret:      "secret",
+}
+
+func describeInstall(args *models.InstallerArguments) installDescription {
+	description := installDescription{
+		Version: installDescriptionVersion,
+		Msis:    []msiDescription{},
+		Files:   []fileDescription{},
+		Sources: map[string]sourceDescription{},
+	}
+
+	for field, source := range args.Sources {
+		description.Sources[field] = sourceDescription{Block: source.Block, Path: source.Path}
+	}
+
+	for _, install := range msiInstalls(args) {
+		properties := map[string]string{}
+		for _, p := range install.Properties {
+			properties[p.Name] = p.Value
+		}
+		description.Msis = append(description.Msis, msiDescription{Name: install.Name, Properties: properties})
+	}
+
+	filenames := []string{}
+	for filename := range args.Certs {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		cert := args.Certs[filename]
+		description.Files = append(description.Files, fileDescription{
+			Path:   filename,
+			Kind:   certKindNames[cert.Kind],
+			Source: sourceDescription{Block: cert.Source.Block, Path: cert.Source.Path},
+		})
+	}
+
+	return description
+}
+
+func renderInstallDescription(format string, args *models.InstallerArguments) []byte {
+	description := describeInstall(args)
+
+	var content []byte
+	var err error
+	if format == "json" {
+		content, err = json.MarshalIndent(description, "", "  ")
+		content = append(content, '\n')
+	} else {
+		content, err = yaml.Marshal(description)
+	}
+	Fatal(err)
+	return content
+}
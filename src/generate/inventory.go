@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"models"
+)
+
+// maxConcurrentCells bounds how many cells writeInventory renders at once.
+const maxConcurrentCells = 8
+
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+
+// inventoryCell is one row of an -inventory file. Zone may be empty, in
+// which case the cell uses the zone from the manifest or -zone. Source names
+// the file and row the cell was read from.
+type inventoryCell struct {
+	Hostname string
+	IP       string
+	Zone     string
+	Source   models.Source
+}
+
+// readInventory parses a CSV file of hostname,ip[,zone] rows. A first row
+// starting with "hostname" is treated as a header and lines starting with #
+// are ignored.
+func readInventory(filename string) ([]inventoryCell, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	cells := []inventoryCell{}
+	hostnames := map[string]bool{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		if row == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "hostname") {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("%s: row %d: expected hostname,ip[,zone] but found %d fields", filename, row, len(record))
+		}
+
+		cell := inventoryCell{
+			Hostname: strings.TrimSpace(record[0]),
+			IP:       strings.TrimSpace(record[1]),
+			Source:   models.Source{Block: fmt.Sprintf("inventory %s row %d", filename, row)},
+		}
+		if len(record) == 3 {
+			cell.Zone = strings.TrimSpace(record[2])
+		}
+
+		if !hostnamePattern.MatchString(cell.Hostname) {
+			return nil, fmt.Errorf("%s: row %d: invalid hostname %q", filename, row, cell.Hostname)
+		}
+		if hostnames[strings.ToLower(cell.Hostname)] {
+			return nil, fmt.Errorf("%s: row %d: duplicate hostname %s", filename, row, cell.Hostname)
+		}
+		hostnames[strings.ToLower(cell.Hostname)] = true
+		if net.ParseIP(cell.IP) == nil {
+			return nil, fmt.Errorf("%s: row %d: invalid IP address %q", filename, row, cell.IP)
+		}
+
+		cells = append(cells, cell)
+	}
+
+	if len(cells) == 0 {
+		return nil, fmt.Errorf("%s: no cells found", filename)
+	}
+	return cells, nil
+}
+
+// writeInventory writes a subdirectory of outputDir for each cell, named
+// after its hostname, with the cell's IP and zone filled into a copy of args.
+// Each copy has its own Sources, recording the values read from the
+// inventory.
+func writeInventory(outputDir, format string, args *models.InstallerArguments, cells []inventoryCell) error {
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		failed []string
+	)
+	limit := make(chan struct{}, maxConcurrentCells)
+
+	for _, cell := range cells {
+		cellArgs := *args
+		cellArgs.Sources = make(map[string]models.Source, len(args.Sources)+2)
+		for field, source := range args.Sources {
+			cellArgs.Sources[field] = source
+		}
+		cellArgs.FillMachineIp(cell.IP)
+		cellArgs.Sources["MachineIp"] = cell.Source
+		if cell.Zone != "" {
+			cellArgs.Zone = cell.Zone
+			cellArgs.Sources["Zone"] = cell.Source
+		}
+
+		wg.Add(1)
+		go func(cell inventoryCell, cellArgs *models.InstallerArguments) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			err := writeOutputDir(path.Join(outputDir, cell.Hostname), format, cellArgs)
+			if err != nil {
+				mutex.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %s", cell.Hostname, err))
+				mutex.Unlock()
+			}
+		}(cell, &cellArgs)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not write %d of %d cells:\n  %s", len(failed), len(cells), strings.Join(failed, "\n  "))
+	}
+	return nil
+}
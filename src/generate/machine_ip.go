@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// machineIpStrategy is a parsed -machineIpFrom value.
+type machineIpStrategy struct {
+	kind  string
+	iface string
+	cidr  *net.IPNet
+}
+
+// parseMachineIpStrategy accepts route, interface:NAME or cidr:NETWORK. An
+// empty value means route.
+func parseMachineIpStrategy(from string) (machineIpStrategy, error) {
+	parts := strings.SplitN(from, ":", 2)
+	switch {
+	case from == "" || from == "route":
+		return machineIpStrategy{kind: "route"}, nil
+	case parts[0] == "interface" && len(parts) == 2 && parts[1] != "":
+		return machineIpStrategy{kind: "interface", iface: parts[1]}, nil
+	case parts[0] == "cidr" && len(parts) == 2:
+		_, cidr, err := net.ParseCIDR(parts[1])
+		if err != nil {
+			return machineIpStrategy{}, err
+		}
+		return machineIpStrategy{kind: "cidr", cidr: cidr}, nil
+	}
+	return machineIpStrategy{}, fmt.Errorf("unknown -machineIpFrom %q, expected route, interface:NAME or cidr:NETWORK", from)
+}
+
+func (s machineIpStrategy) String() string {
+	switch s.kind {
+	case "interface":
+		return "interface " + s.iface
+	case "cidr":
+		return "an interface in " + s.cidr.String()
+	}
+	return "the route to consul"
+}
+
+// detectMachineIp finds the IP of the machine the generator is running on.
+// The route strategy uses the source address of a route to the first
+// reachable consul server, so it is only correct when run on the cell.
+func detectMachineIp(strategy machineIpStrategy, consulIPs []string) (string, error) {
+	switch strategy.kind {
+	case "interface":
+		iface, err := net.InterfaceByName(strategy.iface)
+		if err != nil {
+			return "", fmt.Errorf("interface %s: %s", strategy.iface, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return "", fmt.Errorf("interface %s: %s", strategy.iface, err)
+		}
+		ip := preferredIp(addrs, func(net.IP) bool { return true })
+		if ip == nil {
+			return "", fmt.Errorf("interface %s has no usable IP address", strategy.iface)
+		}
+		return ip.String(), nil
+
+	case "cidr":
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return "", err
+		}
+		ip := preferredIp(addrs, strategy.cidr.Contains)
+		if ip == nil {
+			return "", fmt.Errorf("no interface has an IP address in %s", strategy.cidr)
+		}
+		return ip.String(), nil
+	}
+
+	failures := []string{}
+	for _, consulIp := range consulIPs {
+		consulIp = strings.TrimSpace(consulIp)
+		if consulIp == "" {
+			continue
+		}
+		conn, err := net.Dial("udp", net.JoinHostPort(consulIp, "65530"))
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		localAddr := conn.LocalAddr().String()
+		conn.Close()
+		host, _, err := net.SplitHostPort(localAddr)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		return host, nil
+	}
+	if len(failures) == 0 {
+		return "", errors.New("no consul servers to find a route to, use -machineIp or -machineIpFrom")
+	}
+	return "", fmt.Errorf("could not find a route to any consul server, use -machineIp or -machineIpFrom:\n  %s", strings.Join(failures, "\n  "))
+}
+
+// preferredIp returns the first IPv4 address in addrs accepted by match,
+// falling back to the first IPv6 address. Link-local addresses are skipped.
+func preferredIp(addrs []net.Addr, match func(net.IP) bool) net.IP {
+	var ipv6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() || !match(ipNet.IP) {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP
+		}
+		if ipv6 == nil {
+			ipv6 = ipNet.IP
+		}
+	}
+	return ipv6
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"models"
+)
+
+const (
+	diegoMsi  = "DiegoWindows.msi"
+	gardenMsi = "GardenWindows.msi"
+
+	installPs1Template = `$ErrorActionPreference = "Stop"
+$here = Split-Path -Parent $MyInvocation.MyCommand.Path
+
+function Install-Msi([string]$msi, [string[]]$properties) {
+  $log = Join-Path $here "$msi.log"
+  Write-Host "Installing $msi, logging to $log"
+  $arguments = @("/passive", "/norestart", "/i", ('"{0}"' -f (Join-Path $here $msi)), "/log", ('"{0}"' -f $log)) + $properties
+  $process = Start-Process -FilePath "msiexec.exe" -ArgumentList $arguments -Wait -PassThru
+  $global:LASTEXITCODE = $process.ExitCode
+  # 3010 means the install succeeded but a reboot is required
+  if ($LASTEXITCODE -ne 0 -and $LASTEXITCODE -ne 3010) {
+    Write-Host "$msi failed with exit code $LASTEXITCODE, see $log"
+    exit $LASTEXITCODE
+  }
+  Write-Host "$msi installed"
+}
+{{range .}}
+Install-Msi "{{.Name}}" @({{range $i, $p := .Properties}}{{if $i}},{{end}}
+  {{psArgument $p}}{{end}}
+)
+{{end}}`
+)
+
+// msiProperty is a single NAME=value argument passed to msiexec. File
+// properties hold a path relative to the install script.
+type msiProperty struct {
+	Name  string
+	Value string
+	File  bool
+}
+
+type msiInstall struct {
+	Name       string
+	Properties []msiProperty
+}
+
+// msiInstalls returns the MSIs to install, in order, with the same
+// properties as installBatTemplate.
+func msiInstalls(args *models.InstallerArguments) []msiInstall {
+	diego := []msiProperty{}
+	if args.BbsRequireSsl {
+		diego = append(diego,
+			msiProperty{Name: "BBS_CA_FILE", Value: "bbs_ca.crt", File: true},
+			msiProperty{Name: "BBS_CLIENT_CERT_FILE", Value: "bbs_client.crt", File: true},
+			msiProperty{Name: "BBS_CLIENT_KEY_FILE", Value: "bbs_client.key", File: true},
+		)
+	}
+	diego = append(diego, msiProperty{Name: "REP_REQUIRE_TLS", Value: fmt.Sprint(args.RepRequireTls)})
+	if args.RepRequireTls {
+		diego = append(diego,
+			msiProperty{Name: "REP_CA_CERT_FILE", Value: "rep_ca.crt", File: true},
+			msiProperty{Name: "REP_SERVER_CERT_FILE", Value: "rep_server.crt", File: true},
+			msiProperty{Name: "REP_SERVER_KEY_FILE", Value: "rep_server.key", File: true},
+		)
+	}
+	if args.LocketApiLocation != "" {
+		diego = append(diego,
+			msiProperty{Name: "LOCKET_API_LOCATION", Value: args.LocketApiLocation},
+			msiProperty{Name: "LOCKET_CA_FILE", Value: "locket_ca.crt", File: true},
+			msiProperty{Name: "LOCKET_CLIENT_CERT_FILE", Value: "locket_client.crt", File: true},
+			msiProperty{Name: "LOCKET_CLIENT_KEY_FILE", Value: "locket_client.key", File: true},
+		)
+	}
+	diego = append(diego,
+		msiProperty{Name: "CONSUL_DOMAIN", Value: args.ConsulDomain},
+		msiProperty{Name: "CONSUL_IPS", Value: args.ConsulIPs},
+	)
+	if args.EtcdCluster != "" {
+		diego = append(diego, msiProperty{Name: "CF_ETCD_CLUSTER", Value: args.EtcdCluster})
+	}
+	if args.EtcdRequireSSL {
+		diego = append(diego,
+			msiProperty{Name: "ETCD_CA_FILE", Value: "etcd_ca.crt", File: true},
+			msiProperty{Name: "ETCD_CERT_FILE", Value: "etcd_client.crt", File: true},
+			msiProperty{Name: "ETCD_KEY_FILE", Value: "etcd_client.key", File: true},
+		)
+	}
+	diego = append(diego,
+		msiProperty{Name: "STACK", Value: args.Stack},
+		msiProperty{Name: "REDUNDANCY_ZONE", Value: args.Zone},
+		msiProperty{Name: "LOGGREGATOR_SHARED_SECRET", Value: args.SharedSecret},
+	)
+	diego = append(diego, machineProperties(args)...)
+	if args.ConsulRequireSSL {
+		diego = append(diego,
+			msiProperty{Name: "CONSUL_ENCRYPT_FILE", Value: "consul_encrypt.key", File: true},
+			msiProperty{Name: "CONSUL_CA_FILE", Value: "consul_ca.crt", File: true},
+			msiProperty{Name: "CONSUL_AGENT_CERT_FILE", Value: "consul_agent.crt", File: true},
+			msiProperty{Name: "CONSUL_AGENT_KEY_FILE", Value: "consul_agent.key", File: true},
+		)
+	}
+	if args.MetronPreferTLS {
+		diego = append(diego,
+			msiProperty{Name: "METRON_CA_FILE", Value: "metron_ca.crt", File: true},
+			msiProperty{Name: "METRON_AGENT_CERT_FILE", Value: "metron_agent.crt", File: true},
+			msiProperty{Name: "METRON_AGENT_KEY_FILE", Value: "metron_agent.key", File: true},
+		)
+	}
+	if args.LoggregatorAgent {
+		diego = append(diego,
+			msiProperty{Name: "LOGGREGATOR_AGENT_CA_FILE", Value: "loggregator_ca.crt", File: true},
+			msiProperty{Name: "LOGGREGATOR_AGENT_CERT_FILE", Value: "loggregator_agent.crt", File: true},
+			msiProperty{Name: "LOGGREGATOR_AGENT_KEY_FILE", Value: "loggregator_agent.key", File: true},
+			msiProperty{Name: "LOGGREGATOR_AGENT_GRPC_PORT", Value: fmt.Sprint(args.LoggregatorAgentGrpcPort)},
+		)
+	}
+
+	return []msiInstall{
+		{Name: diegoMsi, Properties: diego},
+		{Name: gardenMsi, Properties: machineProperties(args)},
+	}
+}
+
+func machineProperties(args *models.InstallerArguments) []msiProperty {
+	properties := []msiProperty{{Name: "MACHINE_IP", Value: args.MachineIp}}
+	if args.SyslogHostIP != "" {
+		properties = append(properties,
+			msiProperty{Name: "SYSLOG_HOST_IP", Value: args.SyslogHostIP},
+			msiProperty{Name: "SYSLOG_PORT", Value: args.SyslogPort},
+		)
+	}
+	return properties
+}
+
+// psArgument renders a property as a PowerShell expression evaluating to
+// NAME="value", with the value quoted for msiexec.
+func psArgument(p msiProperty) string {
+	if p.File {
+		return fmt.Sprintf(`('%s="{0}"' -f (Join-Path $here %s))`, p.Name, psQuote(p.Value))
+	}
+	value := strings.Replace(p.Value, `"`, `""`, -1)
+	return psQuote(fmt.Sprintf(`%s="%s"`, p.Name, value))
+}
+
+func psQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
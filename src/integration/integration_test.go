@@ -1,18 +1,26 @@
 package integration_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
+	"runtime"
 	"strings"
 	"text/template"
 
 	"models"
+	"yaml"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -32,6 +40,31 @@ func serverUrl(server *ghttp.Server) string {
 }
 
 func CreateServer(manifest string, deployments []models.IndexDeployment) *ghttp.Server {
+	server := ghttp.NewServer()
+	appendDeploymentHandlers(server, manifest, deployments)
+	return server
+}
+
+func CreateTLSServer(manifest string, deployments []models.IndexDeployment) *ghttp.Server {
+	server := ghttp.NewTLSServer()
+	appendDeploymentHandlers(server, manifest, deployments)
+	return server
+}
+
+func WriteServerCA(server *ghttp.Server) string {
+	caFile, err := ioutil.TempFile("", "bosh_ca")
+	Expect(err).ToNot(HaveOccurred())
+	defer caFile.Close()
+
+	err = pem.Encode(caFile, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.HTTPTestServer.Certificate().Raw,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	return caFile.Name()
+}
+
+func appendDeploymentHandlers(server *ghttp.Server, manifest string, deployments []models.IndexDeployment) {
 	yaml, err := ioutil.ReadFile(manifest)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -39,7 +72,6 @@ func CreateServer(manifest string, deployments []models.IndexDeployment) *ghttp.
 		Manifest: string(yaml),
 	}
 
-	server := ghttp.NewServer()
 	server.AppendHandlers(
 		ghttp.CombineHandlers(
 			ghttp.VerifyRequest("GET", "/info"),
@@ -54,8 +86,6 @@ func CreateServer(manifest string, deployments []models.IndexDeployment) *ghttp.
 			ghttp.RespondWithJSONEncoded(200, diegoDeployment),
 		),
 	)
-
-	return server
 }
 
 func CreateUaaProtectedServer(manifest string, deployments []models.IndexDeployment, uaaEndpoint string) *ghttp.Server {
@@ -98,6 +128,22 @@ func CreateOAuthServer() *ghttp.Server {
 	return server
 }
 
+func CreateClientCredentialsOAuthServer(clientID, clientSecret string) *ghttp.Server {
+	server := ghttp.NewServer()
+	server.AppendHandlers(
+		ghttp.CombineHandlers(
+			ghttp.VerifyRequest("POST", "/oauth/token"),
+			ghttp.VerifyBasicAuth(clientID, clientSecret),
+			func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.FormValue("grant_type")).To(Equal("client_credentials"))
+			},
+			ghttp.RespondWith(200, `{"access_token":"the token","expires_in":3600}`,
+				http.Header{"Content-Type": []string{"application/json"}}),
+		),
+	)
+	return server
+}
+
 func Create401Server() *ghttp.Server {
 	server := ghttp.NewServer()
 	server.AppendHandlers(
@@ -137,12 +183,26 @@ func StartGeneratorWithManifest(manifest string) (*gexec.Session, string) {
 }
 
 func StartGeneratorWithArgs(args ...string) *gexec.Session {
-	command := exec.Command(generatePath, args...)
+	command := generatorCommand(args...)
 	session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
 	Expect(err).NotTo(HaveOccurred())
 	return session
 }
 
+// generatorCommand returns the command to run the generator with args. The
+// certificates in the fixtures are placeholders, so generate runs skip
+// certificate validation unless args turn it back on with
+// -skipCertValidation=false.
+func generatorCommand(args ...string) *exec.Cmd {
+	switch {
+	case len(args) > 0 && strings.HasPrefix(args[0], "-"):
+		args = append([]string{"-skipCertValidation"}, args...)
+	case len(args) > 0 && args[0] == "generate":
+		args = append([]string{"generate", "-skipCertValidation"}, args[1:]...)
+	}
+	return exec.Command(generatePath, args...)
+}
+
 func DefaultIndexDeployment() []models.IndexDeployment {
 	return []models.IndexDeployment{
 		{
@@ -246,9 +306,9 @@ func ExpectedContent(args models.InstallerArguments) string {
   REP_SERVER_KEY_FILE=%~dp0\rep_server.key ^{{ end }}
   CONSUL_DOMAIN={{.ConsulDomain}} ^
   CONSUL_IPS=127.0.0.1 ^
-  CF_ETCD_CLUSTER=http://etcd-server-0.node.cf.internal:4001 ^
-  STACK=windows2012R2 ^
-  REDUNDANCY_ZONE=windows ^
+  CF_ETCD_CLUSTER=http://etcd1.foo.bar:4001 ^
+  STACK={{if .Stack}}{{.Stack}}{{else}}windows2012R2{{end}} ^
+  REDUNDANCY_ZONE={{if .Zone}}{{.Zone}}{{else}}zone1{{end}} ^
   LOGGREGATOR_SHARED_SECRET=secret123 ^
   MACHINE_IP={{if .MachineIp }}{{.MachineIp}}{{else}}127.0.0.1{{end}}{{ if .SyslogHostIP }} ^
   SYSLOG_HOST_IP=logs2.test.com ^
@@ -318,27 +378,918 @@ var _ = Describe("Generate", func() {
 			Expect(oauthServer.ReceivedRequests()).Should(HaveLen(1))
 			Expect(uaaServer.ReceivedRequests()).Should(HaveLen(3))
 		})
-	})
 
-	Describe("Success scenarios", func() {
-		Context("when a CF manifest is supplied", func() {
-			It("should work", func() {
-				session, outputDir = StartGeneratorWithManifest(manifestYaml)
+		Context("with client credentials", func() {
+			BeforeEach(func() {
+				oauthServer.Close()
+				uaaServer.Close()
+				oauthServer = CreateClientCredentialsOAuthServer("ci", "s3cret")
+				uaaServer = CreateUaaProtectedServer(manifestYaml, deployments, oauthServer.URL())
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("authenticates with -boshClient and -boshClientSecret", func() {
+				session = StartGeneratorWithArgs(
+					"-boshUrl", uaaServer.URL(),
+					"-outputDir", outputDir,
+					"-boshClient", "ci",
+					"-boshClientSecret", "s3cret",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(oauthServer.ReceivedRequests()).Should(HaveLen(1))
+				Expect(uaaServer.ReceivedRequests()).Should(HaveLen(3))
+			})
+
+			It("authenticates with $BOSH_CLIENT and $BOSH_CLIENT_SECRET", func() {
+				command := generatorCommand(
+					"-boshUrl", uaaServer.URL(),
+					"-outputDir", outputDir,
+				)
+				command.Env = append(os.Environ(), "BOSH_CLIENT=ci", "BOSH_CLIENT_SECRET=s3cret")
+				var err error
+				session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(oauthServer.ReceivedRequests()).Should(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("TLS verification", func() {
+		var tlsServer *ghttp.Server
+		var caFile string
+
+		BeforeEach(func() {
+			tlsServer = CreateTLSServer(manifestYaml, deployments)
+			caFile = WriteServerCA(tlsServer)
+			var err error
+			outputDir, err = ioutil.TempDir("", "XXXXXXX")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			tlsServer.Close()
+			Expect(os.Remove(caFile)).To(Succeed())
+		})
+
+		It("fails when the director certificate cannot be verified", func() {
+			session = StartGeneratorWithArgs(
+				"-boshUrl", serverUrl(tlsServer),
+				"-outputDir", outputDir,
+			)
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("Unable to establish connection to BOSH Director"))
+		})
+
+		It("verifies the director certificate against -boshCACert", func() {
+			session = StartGeneratorWithArgs(
+				"-boshUrl", serverUrl(tlsServer),
+				"-outputDir", outputDir,
+				"-boshCACert", caFile,
+			)
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(tlsServer.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("verifies the director certificate against $BOSH_CA_CERT", func() {
+			command := generatorCommand(
+				"-boshUrl", serverUrl(tlsServer),
+				"-outputDir", outputDir,
+			)
+			command.Env = append(os.Environ(), "BOSH_CA_CERT="+caFile)
+			var err error
+			session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("skips verification with a warning when -insecure is given", func() {
+			session = StartGeneratorWithArgs(
+				"-boshUrl", serverUrl(tlsServer),
+				"-outputDir", outputDir,
+				"-insecure",
+			)
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(session.Err).Should(gbytes.Say("Warning: TLS certificate verification"))
+		})
+
+		Context("when insecure is set in several places", func() {
+			var configFile string
+
+			BeforeEach(func() {
+				configFile = path.Join(outputDir, "config.yml")
+				Expect(ioutil.WriteFile(configFile, []byte("insecure: true\n"), 0600)).To(Succeed())
+			})
+
+			start := func(args ...string) {
+				command := generatorCommand(append([]string{
+					"-boshUrl", serverUrl(tlsServer),
+					"-outputDir", outputDir,
+					"-config", configFile,
+				}, args...)...)
+				var err error
+				session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			It("reads it from -config", func() {
+				start()
+				Eventually(session).Should(gexec.Exit(0))
+			})
+
+			It("prefers -insecure to -config", func() {
+				start("-insecure=false")
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("Unable to establish connection to BOSH Director"))
+			})
+		})
+	})
+
+	Describe("BOSH settings", func() {
+		var configFile string
+
+		BeforeEach(func() {
+			var err error
+			outputDir, err = ioutil.TempDir("", "XXXXXXX")
+			Expect(err).NotTo(HaveOccurred())
+			configFile = path.Join(outputDir, "config.yml")
+		})
+
+		startWithEnv := func(env []string, args ...string) *gexec.Session {
+			command := generatorCommand(append(args, "-outputDir", path.Join(outputDir, "bundle"))...)
+			command.Env = append(os.Environ(), env...)
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			return session
+		}
+
+		writeConfig := func(config string) {
+			Expect(ioutil.WriteFile(configFile, []byte(config), 0600)).To(Succeed())
+		}
+
+		It("reads the director and credentials from -config", func() {
+			writeConfig(fmt.Sprintf("environment: %s\nclient: admin\nclient_secret: s3cret\ndeployment: cf-warden-diego\n", server.URL()))
+			session = startWithEnv(nil, "-config", configFile)
+			Eventually(session).Should(gexec.Exit(0))
+
+			requests := server.ReceivedRequests()
+			Expect(requests).To(HaveLen(3))
+			username, password, ok := requests[1].BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(username).To(Equal("admin"))
+			Expect(password).To(Equal("s3cret"))
+		})
+
+		It("reads the director and credentials from the bosh CLI environment variables", func() {
+			session = startWithEnv([]string{
+				"BOSH_ENVIRONMENT=" + server.URL(),
+				"BOSH_CLIENT=admin",
+				"BOSH_CLIENT_SECRET=s3cret",
+			})
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(session.Err).ShouldNot(gbytes.Say("Warning: credentials in the director URL"))
+		})
+
+		It("prefers environment variables to -config", func() {
+			writeConfig("environment: http://127.0.0.1:1\nclient: admin\nclient_secret: s3cret\n")
+			session = startWithEnv([]string{"BOSH_ENVIRONMENT=" + server.URL()}, "-config", configFile)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("prefers flags to environment variables", func() {
+			session = startWithEnv([]string{
+				"BOSH_ENVIRONMENT=" + server.URL(),
+				"BOSH_CLIENT=admin",
+				"BOSH_CLIENT_SECRET=s3cret",
+				"BOSH_DEPLOYMENT=cf-warden",
+			}, "-deployment", "missing")
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("BOSH Director does not have a deployment named missing"))
+		})
+
+		It("ignores the environment when -manifest is given", func() {
+			session = startWithEnv([]string{"BOSH_ENVIRONMENT=" + server.URL()}, "-manifest", "syslog_manifest.yml", "-machineIp", "10.10.3.21")
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("warns about credentials in the director URL", func() {
+			session = startWithEnv(nil, "-boshUrl", serverUrl(server))
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(session.Err).Should(gbytes.Say("Warning: credentials in the director URL end up in shell history"))
+		})
+
+		It("requires credentials", func() {
+			session = startWithEnv(nil, "-boshUrl", server.URL())
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("Director credentials are required"))
+		})
+	})
+
+	Describe("Success scenarios", func() {
+		Context("when a CF manifest is supplied", func() {
+			It("should work", func() {
+				session, outputDir = StartGeneratorWithManifest(manifestYaml)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+				script = strings.TrimSpace(string(content))
+
+				expectedContent := ExpectedContent(models.InstallerArguments{
+					ConsulRequireSSL: true,
+					SyslogHostIP:     "logs2.test.com",
+					BbsRequireSsl:    true,
+					Username:         "admin",
+					Password:         `"""password"""`,
+					ConsulDomain:     "cf.internal",
+				})
+
+				Expect(script).To(Equal(expectedContent))
+			})
+		})
+
+		Context("when the CF manifest contains variables", func() {
+			BeforeEach(func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("resolves them from -vars-file and -var", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "vars_manifest.yml",
+					"-outputDir", outputDir,
+					"-vars-file", "vars.yml",
+					"-var", "syslog_host=logs2.test.com",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectedContent := ExpectedContent(models.InstallerArguments{
+					ConsulRequireSSL: true,
+					SyslogHostIP:     "logs2.test.com",
+					BbsRequireSsl:    true,
+					ConsulDomain:     "cf.internal",
+				})
+				Expect(strings.TrimSpace(string(content))).To(Equal(expectedContent))
+
+				cert, err := ioutil.ReadFile(path.Join(outputDir, "bbs_client.key"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cert).To(BeEquivalentTo("BBS_CLIENT_KEY"))
+			})
+
+			It("fails listing every unresolved variable", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "vars_manifest.yml",
+					"-outputDir", outputDir,
+					"-vars-store", "vars.yml",
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("unresolved variables"))
+				Expect(session.Err).Should(gbytes.Say("syslog_host"))
+			})
+		})
+
+		Context("when ops files are supplied", func() {
+			BeforeEach(func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("applies them before extracting the installer arguments", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "one_zone_manifest.yml",
+					"-outputDir", outputDir,
+					"-ops-file", "windows_syslog_ops.yml",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectedContent := ExpectedContent(models.InstallerArguments{
+					ConsulRequireSSL: true,
+					SyslogHostIP:     "logs2.test.com",
+					BbsRequireSsl:    true,
+					ConsulDomain:     "cf.internal",
+				})
+				Expect(strings.TrimSpace(string(content))).To(Equal(expectedContent))
+			})
+
+			It("fails when an ops file path does not resolve", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "one_zone_manifest.yml",
+					"-outputDir", outputDir,
+					"-ops-file", "bad_path_ops.yml",
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("applying bad_path_ops.yml: operation \\[0\\] replace"))
+				Expect(session.Err).Should(gbytes.Say("expected to find a map key 'instance_groups'"))
+			})
+		})
+
+		Context("when the ps1 format is requested", func() {
+			var script string
+
+			BeforeEach(func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", "vars_manifest.yml",
+					"-outputDir", outputDir,
+					"-vars-file", "vars.yml",
+					"-var", "syslog_host=logs2.test.com",
+					"-var", `metron_shared_secret=it's"secret`,
+					"-machineIp", "10.10.3.21",
+					"-format", "ps1",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.ps1"))
+				Expect(err).NotTo(HaveOccurred())
+				script = string(content)
+			})
+
+			It("writes install.ps1 instead of install.bat", func() {
+				_, err := os.Stat(path.Join(outputDir, "install.bat"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			It("waits for msiexec and checks its exit code", func() {
+				Expect(script).To(ContainSubstring(`Start-Process -FilePath "msiexec.exe" -ArgumentList $arguments -Wait -PassThru`))
+				Expect(script).To(ContainSubstring(`if ($LASTEXITCODE -ne 0 -and $LASTEXITCODE -ne 3010) {`))
+			})
+
+			It("installs DiegoWindows.msi before GardenWindows.msi", func() {
+				diego := strings.Index(script, `Install-Msi "DiegoWindows.msi"`)
+				garden := strings.Index(script, `Install-Msi "GardenWindows.msi"`)
+				Expect(diego).To(BeNumerically(">", 0))
+				Expect(garden).To(BeNumerically(">", diego))
+			})
+
+			It("quotes the MSI properties", func() {
+				Expect(script).To(ContainSubstring("\r\n  ('BBS_CA_FILE=\"{0}\"' -f (Join-Path $here 'bbs_ca.crt')),\r\n"))
+				Expect(script).To(ContainSubstring("\r\n  'LOGGREGATOR_SHARED_SECRET=\"it''s\"\"secret\"',\r\n"))
+				Expect(script).To(ContainSubstring("\r\n  'MACHINE_IP=\"10.10.3.21\"',\r\n"))
+			})
+		})
+
+		Context("when a machine-readable format is requested", func() {
+			type installDescription struct {
+				Version int `json:"version" yaml:"version"`
+				Msis    []struct {
+					Name       string            `json:"name" yaml:"name"`
+					Properties map[string]string `json:"properties" yaml:"properties"`
+				} `json:"msis" yaml:"msis"`
+				Files []struct {
+					Path string `json:"path" yaml:"path"`
+					Kind string `json:"kind" yaml:"kind"`
+				} `json:"files" yaml:"files"`
+			}
+
+			generate := func(format string) []byte {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", outputDir,
+					"-machineIp", "10.10.3.21",
+					"-format", format,
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install."+format))
+				Expect(err).NotTo(HaveOccurred())
+				return content
+			}
+
+			verify := func(description installDescription) {
+				Expect(description.Version).To(Equal(1))
+				Expect(description.Msis).To(HaveLen(2))
+
+				Expect(description.Msis[0].Name).To(Equal("DiegoWindows.msi"))
+				Expect(description.Msis[0].Properties).To(HaveKeyWithValue("BBS_CA_FILE", "bbs_ca.crt"))
+				Expect(description.Msis[0].Properties).To(HaveKeyWithValue("CONSUL_IPS", "127.0.0.1"))
+				Expect(description.Msis[0].Properties).To(HaveKeyWithValue("REP_REQUIRE_TLS", "false"))
+				Expect(description.Msis[0].Properties).To(HaveKeyWithValue("SYSLOG_HOST_IP", "logs2.test.com"))
+				Expect(description.Msis[0].Properties).To(HaveKeyWithValue("LOGGREGATOR_SHARED_SECRET", "secret123"))
+
+				Expect(description.Msis[1].Name).To(Equal("GardenWindows.msi"))
+				Expect(description.Msis[1].Properties).To(Equal(map[string]string{
+					"MACHINE_IP":     "10.10.3.21",
+					"SYSLOG_HOST_IP": "logs2.test.com",
+					"SYSLOG_PORT":    "11111",
+				}))
+
+				Expect(description.Files).NotTo(BeEmpty())
+				Expect(description.Files[0].Path).To(Equal("bbs_ca.crt"))
+				Expect(description.Files[0].Kind).To(Equal("ca_cert"))
+				for _, file := range description.Files {
+					_, err := os.Stat(path.Join(outputDir, file.Path))
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+
+			It("writes install.json", func() {
+				var description installDescription
+				Expect(json.Unmarshal(generate("json"), &description)).To(Succeed())
+				verify(description)
+
+				_, err := os.Stat(path.Join(outputDir, "install.bat"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			It("includes where each value and file came from", func() {
+				var description struct {
+					Files []struct {
+						Path   string `json:"path"`
+						Source struct {
+							Block string `json:"block"`
+							Path  string `json:"path"`
+						} `json:"source"`
+					} `json:"files"`
+					Sources map[string]struct {
+						Block string `json:"block"`
+						Path  string `json:"path"`
+					} `json:"sources"`
+				}
+				Expect(json.Unmarshal(generate("json"), &description)).To(Succeed())
+
+				Expect(description.Sources["Zone"].Block).To(Equal("job 0"))
+				Expect(description.Sources["Zone"].Path).To(Equal("/jobs/0/properties/diego/rep/zone"))
+				Expect(description.Sources["ConsulDomain"].Block).To(Equal("default"))
+				Expect(description.Sources["MachineIp"].Block).To(Equal("-machineIp"))
+				Expect(description.Files[0].Path).To(Equal("bbs_ca.crt"))
+				Expect(description.Files[0].Source.Block).To(Equal("global properties"))
+				Expect(description.Files[0].Source.Path).To(Equal("/properties/diego/rep/bbs/ca_cert"))
+			})
+
+			It("writes install.yaml", func() {
+				var description installDescription
+				Expect(yaml.Unmarshal(generate("yaml"), &description)).To(Succeed())
+				verify(description)
+			})
+		})
+
+		Context("when -bundle is given", func() {
+			var (
+				bundleDir string
+				msiDir    string
+			)
+
+			BeforeEach(func() {
+				var err error
+				bundleDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				msiDir = path.Join(bundleDir, "msis")
+				Expect(os.Mkdir(msiDir, 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(msiDir, "DiegoWindows.msi"), []byte("diego msi"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(msiDir, "GardenWindows.msi"), []byte("garden msi"), 0644)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(bundleDir)
+			})
+
+			readBundle := func(bundle string) map[string]string {
+				reader, err := zip.OpenReader(bundle)
+				Expect(err).NotTo(HaveOccurred())
+				defer reader.Close()
+
+				entries := map[string]string{}
+				for _, f := range reader.File {
+					rc, err := f.Open()
+					Expect(err).NotTo(HaveOccurred())
+					contents, err := ioutil.ReadAll(rc)
+					Expect(err).NotTo(HaveOccurred())
+					rc.Close()
+					entries[f.Name] = string(contents)
+				}
+				return entries
+			}
+
+			It("writes the script, certs, MSIs and their checksums to a private zip", func() {
+				bundle := path.Join(bundleDir, "cell.zip")
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-machineIp", "10.10.3.21",
+					"-bundle", bundle,
+					"-msiDir", msiDir,
+				)
+				Eventually(session).Should(gexec.Exit(0))
+
+				info, err := os.Stat(bundle)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+				entries := readBundle(bundle)
+				Expect(entries["install.bat"]).To(ContainSubstring("MACHINE_IP=10.10.3.21"))
+				Expect(entries["bbs_client.key"]).To(Equal("BBS_CLIENT_KEY"))
+				Expect(entries["DiegoWindows.msi"]).To(Equal("diego msi"))
+				Expect(entries["GardenWindows.msi"]).To(Equal("garden msi"))
+
+				checksums := strings.Split(strings.TrimSpace(entries["SHA256SUMS"]), "\n")
+				Expect(checksums).To(HaveLen(len(entries) - 1))
+				for _, line := range checksums {
+					parts := strings.SplitN(line, "  ", 2)
+					Expect(parts).To(HaveLen(2))
+					sum := sha256.Sum256([]byte(entries[parts[1]]))
+					Expect(parts[0]).To(Equal(hex.EncodeToString(sum[:])), parts[1])
+				}
+			})
+
+			It("omits the MSIs when -msiDir is not given", func() {
+				bundle := path.Join(bundleDir, "cell.zip")
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-machineIp", "10.10.3.21",
+					"-bundle", bundle,
+					"-format", "ps1",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+
+				entries := readBundle(bundle)
+				Expect(entries).To(HaveKey("install.ps1"))
+				Expect(entries).To(HaveKey("SHA256SUMS"))
+				Expect(entries).NotTo(HaveKey("DiegoWindows.msi"))
+			})
+
+			It("fails without leaving a bundle behind when an MSI is missing", func() {
+				Expect(os.Remove(path.Join(msiDir, "GardenWindows.msi"))).To(Succeed())
+				bundle := path.Join(bundleDir, "cell.zip")
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-machineIp", "10.10.3.21",
+					"-bundle", bundle,
+					"-msiDir", msiDir,
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("GardenWindows.msi"))
+
+				_, err := os.Stat(bundle)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			Context("when the bundle is encrypted", func() {
+				var (
+					bundle         string
+					identity       string
+					publicKey      string
+					passphraseFile string
+				)
+
+				BeforeEach(func() {
+					identity = path.Join(bundleDir, "identity.pem")
+					session = StartGeneratorWithArgs("keygen", "-out", identity)
+					Eventually(session).Should(gexec.Exit(0))
+					publicKey = path.Join(bundleDir, "identity.pub")
+					Expect(ioutil.WriteFile(publicKey, session.Out.Contents(), 0644)).To(Succeed())
+
+					info, err := os.Stat(identity)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+					passphraseFile = path.Join(bundleDir, "passphrase")
+					Expect(ioutil.WriteFile(passphraseFile, []byte("correct horse\n"), 0600)).To(Succeed())
+
+					bundle = path.Join(bundleDir, "cell.zip.enc")
+					session = StartGeneratorWithArgs(
+						"-manifest", "syslog_manifest.yml",
+						"-machineIp", "10.10.3.21",
+						"-bundle", bundle,
+						"-encryptTo", publicKey,
+					)
+					Eventually(session).Should(gexec.Exit(0))
+				})
+
+				encryptWithPassphrase := func() {
+					session = StartGeneratorWithArgs(
+						"-manifest", "syslog_manifest.yml",
+						"-machineIp", "10.10.3.21",
+						"-bundle", bundle,
+						"-passphraseFile", passphraseFile,
+					)
+					Eventually(session, 5).Should(gexec.Exit(0))
+				}
+
+				// rewriteHeader replaces the keys in the bundle header with
+				// the result of edit, leaving the sealed zip as it is.
+				rewriteHeader := func(edit func(keys []interface{}) []interface{}) {
+					contents, err := ioutil.ReadFile(bundle)
+					Expect(err).NotTo(HaveOccurred())
+					lines := bytes.SplitN(contents, []byte("\n"), 3)
+					var header map[string][]interface{}
+					Expect(json.Unmarshal(lines[1], &header)).To(Succeed())
+					header["keys"] = edit(header["keys"])
+					lines[1], err = json.Marshal(header)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ioutil.WriteFile(bundle, bytes.Join(lines, []byte("\n")), 0600)).To(Succeed())
+				}
+
+				It("is not a readable zip", func() {
+					_, err := zip.OpenReader(bundle)
+					Expect(err).To(HaveOccurred())
+				})
+
+				It("can be decrypted with the private key", func() {
+					decrypted := path.Join(bundleDir, "cell.zip")
+					session = StartGeneratorWithArgs("decrypt", "-in", bundle, "-out", decrypted, "-identity", identity)
+					Eventually(session).Should(gexec.Exit(0))
+					Expect(readBundle(decrypted)["bbs_client.key"]).To(Equal("BBS_CLIENT_KEY"))
+
+					info, err := os.Stat(decrypted)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+				})
+
+				It("can be decrypted with the passphrase", func() {
+					encryptWithPassphrase()
+					decrypted := path.Join(bundleDir, "cell.zip")
+					session = StartGeneratorWithArgs("decrypt", "-in", bundle, "-out", decrypted, "-passphraseFile", passphraseFile)
+					Eventually(session).Should(gexec.Exit(0))
+					Expect(readBundle(decrypted)).To(HaveKey("install.bat"))
+				})
+
+				It("cannot be decrypted with another passphrase", func() {
+					encryptWithPassphrase()
+					Expect(ioutil.WriteFile(passphraseFile, []byte("battery staple"), 0600)).To(Succeed())
+					session = StartGeneratorWithArgs("decrypt", "-in", bundle, "-out", path.Join(bundleDir, "cell.zip"), "-passphraseFile", passphraseFile)
+					Eventually(session, 5).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("none of the given keys or passphrases can decrypt the bundle"))
+				})
+
+				It("detects a modified bundle", func() {
+					contents, err := ioutil.ReadFile(bundle)
+					Expect(err).NotTo(HaveOccurred())
+					contents[len(contents)-1] ^= 1
+					Expect(ioutil.WriteFile(bundle, contents, 0600)).To(Succeed())
+
+					session = StartGeneratorWithArgs("decrypt", "-in", bundle, "-out", path.Join(bundleDir, "cell.zip"), "-identity", identity)
+					Eventually(session).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("the bundle has been modified or is corrupt"))
+				})
+
+				It("rejects a header with more than one passphrase key", func() {
+					encryptWithPassphrase()
+					rewriteHeader(func(keys []interface{}) []interface{} {
+						return append(keys, keys[0])
+					})
+
+					session = StartGeneratorWithArgs("decrypt", "-in", bundle, "-out", path.Join(bundleDir, "cell.zip"), "-passphraseFile", passphraseFile)
+					Eventually(session).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("the bundle header has a passphrase key alongside other keys"))
+				})
+
+				It("rejects a header with too many keys", func() {
+					rewriteHeader(func(keys []interface{}) []interface{} {
+						for len(keys) <= 64 {
+							keys = append(keys, keys[0])
+						}
+						return keys
+					})
+
+					session = StartGeneratorWithArgs("decrypt", "-in", bundle, "-out", path.Join(bundleDir, "cell.zip"), "-identity", identity)
+					Eventually(session).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("the bundle header has 65 keys, at most 64 are allowed"))
+				})
+
+				It("cannot be encrypted to both a key and a passphrase", func() {
+					session = StartGeneratorWithArgs(
+						"-manifest", "syslog_manifest.yml",
+						"-machineIp", "10.10.3.21",
+						"-bundle", bundle,
+						"-encryptTo", publicKey,
+						"-passphraseFile", passphraseFile,
+					)
+					Eventually(session).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("-encryptTo and -passphraseFile cannot be combined"))
+				})
+			})
+
+			It("requires -bundle when encrypting", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", bundleDir,
+					"-passphraseFile", path.Join(bundleDir, "passphrase"),
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("-encryptTo and -passphraseFile require -bundle"))
+			})
+
+			It("requires -bundle when -msiDir is given", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", bundleDir,
+					"-msiDir", msiDir,
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("-msiDir requires -bundle"))
+			})
+		})
+
+		Context("when detecting the machine IP", func() {
+			var script string
+
+			run := func(args ...string) {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(append([]string{
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", outputDir,
+				}, args...)...)
+				Eventually(session, 10).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+				script = string(content)
+			}
+
+			It("uses the address in the given network", func() {
+				run("-machineIpFrom", "cidr:127.0.0.0/8")
+				Expect(script).To(ContainSubstring("MACHINE_IP=127.0.0.1 ^"))
+			})
+
+			It("uses the address of the given interface", func() {
+				interfaces, err := net.Interfaces()
+				Expect(err).NotTo(HaveOccurred())
+				loopback := ""
+				for _, iface := range interfaces {
+					if iface.Flags&net.FlagLoopback != 0 {
+						loopback = iface.Name
+					}
+				}
+				Expect(loopback).NotTo(BeEmpty())
+
+				run("-machineIpFrom", "interface:"+loopback)
+				Expect(script).To(ContainSubstring("MACHINE_IP=127.0.0.1 ^"))
+			})
+
+			It("tries each consul server until one is reachable", func() {
+				run("-ops-file", "unresolvable_consul_ops.yml")
+				Expect(script).To(ContainSubstring("MACHINE_IP=127.0.0.1 ^"))
+			})
+
+			It("rejects unknown strategies", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", os.TempDir(),
+					"-machineIpFrom", "dhcp",
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say(`unknown -machineIpFrom "dhcp", expected route, interface:NAME or cidr:NETWORK`))
+			})
+		})
+
+		Context("when -inventory is given", func() {
+			It("writes a directory for each cell with its own IP and zone", func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", outputDir,
+					"-inventory", "cells.csv",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+
+				expected := map[string][]string{
+					"cell-1": {"10.10.3.21", "zone1"},
+					"cell-2": {"10.10.3.22", "zone1"},
+					"cell-3": {"10.10.4.21", "zone2"},
+				}
+				for hostname, cell := range expected {
+					content, err := ioutil.ReadFile(path.Join(outputDir, hostname, "install.bat"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(content)).To(ContainSubstring("MACHINE_IP=" + cell[0] + " ^"))
+					Expect(string(content)).To(ContainSubstring("REDUNDANCY_ZONE=" + cell[1] + " ^"))
+
+					_, err = os.Stat(path.Join(outputDir, hostname, "bbs_client.key"))
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				files, err := ioutil.ReadDir(outputDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(HaveLen(3))
+			})
+
+			It("records the inventory row as the source of each cell's IP and zone", func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", outputDir,
+					"-inventory", "cells.csv",
+					"-format", "json",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+
+				sources := func(hostname string) map[string]struct {
+					Block string `json:"block"`
+					Path  string `json:"path"`
+				} {
+					var description struct {
+						Sources map[string]struct {
+							Block string `json:"block"`
+							Path  string `json:"path"`
+						} `json:"sources"`
+					}
+					content, err := ioutil.ReadFile(path.Join(outputDir, hostname, "install.json"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(json.Unmarshal(content, &description)).To(Succeed())
+					return description.Sources
+				}
+
+				cell1 := sources("cell-1")
+				Expect(cell1["MachineIp"].Block).To(Equal("inventory cells.csv row 2"))
+				Expect(cell1["Zone"].Path).To(Equal("/jobs/0/properties/diego/rep/zone"))
+
+				cell3 := sources("cell-3")
+				Expect(cell3["MachineIp"].Block).To(Equal("inventory cells.csv row 4"))
+				Expect(cell3["Zone"].Block).To(Equal("inventory cells.csv row 4"))
+				Expect(cell3["Zone"].Path).To(BeEmpty())
+			})
+
+			It("reports invalid rows before writing anything", func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", outputDir,
+					"-inventory", "bad_ip_cells.csv",
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say(`bad_ip_cells.csv: row 2: invalid IP address "10.10.3.300"`))
+
+				files, err := ioutil.ReadDir(outputDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(BeEmpty())
+			})
+
+			It("cannot be combined with -machineIp", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", os.TempDir(),
+					"-inventory", "cells.csv",
+					"-machineIp", "10.10.3.21",
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("-inventory requires -outputDir and cannot be combined with -machineIp"))
+			})
+		})
+
+		Context("when -explain is given", func() {
+			It("prints where each value and cert came from", func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", outputDir,
+					"-machineIp", "10.10.3.21",
+					"-explain",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).Should(gbytes.Say(`SyslogHostIP\s+logs2.test.com\s+global properties /properties/syslog_daemon_config/address`))
+				Expect(session.Out).Should(gbytes.Say(`MachineIp\s+10.10.3.21\s+-machineIp`))
+				Expect(session.Out).Should(gbytes.Say(`FILE\s+SOURCE`))
+				Expect(session.Out).Should(gbytes.Say(`bbs_client.key\s+global properties /properties/diego/rep/bbs/client_key`))
+				Expect(session.Out).Should(gbytes.Say(`consul_encrypt.key\s+global properties /properties/consul/encrypt_keys/0`))
+				Expect(session.Out).ShouldNot(gbytes.Say("secret123"))
+			})
+		})
+
+		Context("when -dry-run is given", func() {
+			It("prints the install script and certificates without writing files", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-machineIp", "10.10.3.21",
+					"-dry-run",
+				)
 				Eventually(session).Should(gexec.Exit(0))
-				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
-				Expect(err).NotTo(HaveOccurred())
-				script = strings.TrimSpace(string(content))
-
-				expectedContent := ExpectedContent(models.InstallerArguments{
-					ConsulRequireSSL: true,
-					SyslogHostIP:     "logs2.test.com",
-					BbsRequireSsl:    true,
-					Username:         "admin",
-					Password:         `"""password"""`,
-					ConsulDomain:     "cf.internal",
-				})
+				Expect(session.Out).Should(gbytes.Say("==> install.bat <=="))
+				Expect(session.Out).Should(gbytes.Say("LOGGREGATOR_SHARED_SECRET=<redacted>"))
+				Expect(session.Out).Should(gbytes.Say(`FILE\s+SUBJECT\s+EXPIRES`))
+				Expect(session.Out).Should(gbytes.Say(`bbs_ca.crt\s+\(no PEM encoded certificate found\)`))
+				Expect(session.Out).Should(gbytes.Say(`bbs_client.key\s+<redacted>`))
+				Expect(session.Out).Should(gbytes.Say(`consul_encrypt.key\s+<redacted>`))
+				Expect(session.Out).ShouldNot(gbytes.Say("secret123"))
+			})
 
-				Expect(script).To(Equal(expectedContent))
+			It("prints secrets when -show-secrets is given", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-machineIp", "10.10.3.21",
+					"-dry-run",
+					"-show-secrets",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).Should(gbytes.Say("LOGGREGATOR_SHARED_SECRET=secret123"))
+				Expect(session.Out).Should(gbytes.Say("==> bbs_client.key <==\nBBS_CLIENT_KEY"))
 			})
 		})
 
@@ -561,6 +1512,17 @@ var _ = Describe("Generate", func() {
 				})
 			})
 
+			Context("when the deployment does not run etcd", func() {
+				BeforeEach(func() {
+					manifestYaml = "no_etcd_manifest.yml"
+				})
+
+				It("omits the etcd cluster", func() {
+					Expect(script).NotTo(ContainSubstring("CF_ETCD_CLUSTER"))
+					Expect(script).To(ContainSubstring("CONSUL_IPS=127.0.0.1 ^\r\n  STACK=windows2012R2 ^"))
+				})
+			})
+
 			Context("When the consul domain is specified", func() {
 				BeforeEach(func() {
 					manifestYaml = "no_consul_or_bbs_cert_manifest.yml"
@@ -629,6 +1591,24 @@ var _ = Describe("Generate", func() {
 				})
 			})
 
+			Context("BOSH 2.0 manifests with job properties", func() {
+				BeforeEach(func() {
+					manifestYaml = "two_point_oh_job_properties_manifest.yml"
+				})
+
+				It("picks up properties from the jobs of the instance group", func() {
+					expectedContent := ExpectedContent(models.InstallerArguments{
+						ConsulRequireSSL: true,
+						SyslogHostIP:     "logs2.test.com",
+						BbsRequireSsl:    true,
+						Username:         "admin",
+						Password:         `"""password"""`,
+						ConsulDomain:     "cf.internal",
+					})
+					Expect(script).To(Equal(expectedContent))
+				})
+			})
+
 			Context("When the rep has requireTls", func() {
 				BeforeEach(func() {
 					manifestYaml = "two_point_oh_manifest_rep_tls.yml"
@@ -650,6 +1630,244 @@ var _ = Describe("Generate", func() {
 			})
 		})
 
+		Context("with an explicit deployment", func() {
+			BeforeEach(func() {
+				deployments = AmbiguousIndexDeployment()
+			})
+
+			It("uses the named deployment", func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-boshUrl", serverUrl(server),
+					"-outputDir", outputDir,
+					"-deployment", "cf-warden-diego",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(server.ReceivedRequests()).To(HaveLen(3))
+			})
+		})
+
+		Context("when the cell runs the loggregator agent", func() {
+			generate := func(format string) string {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", "two_point_oh_job_properties_manifest.yml",
+					"-ops-file", "loggregator_agent_ops.yml",
+					"-outputDir", outputDir,
+					"-machineIp", "10.10.3.21",
+					"-format", format,
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install."+format))
+				Expect(err).NotTo(HaveOccurred())
+				return string(content)
+			}
+
+			It("passes the agent certs and gRPC port to the Diego MSI", func() {
+				script := generate("bat")
+				Expect(script).To(ContainSubstring(strings.Join([]string{
+					`  CONSUL_AGENT_KEY_FILE=%~dp0\consul_agent.key ^`,
+					`  LOGGREGATOR_AGENT_CA_FILE=%~dp0\loggregator_ca.crt ^`,
+					`  LOGGREGATOR_AGENT_CERT_FILE=%~dp0\loggregator_agent.crt ^`,
+					`  LOGGREGATOR_AGENT_KEY_FILE=%~dp0\loggregator_agent.key ^`,
+					`  LOGGREGATOR_AGENT_GRPC_PORT=3459`,
+				}, "\r\n")))
+
+				for filename, contents := range map[string]string{
+					"loggregator_ca.crt":    "LOGGREGATOR_CA_CERT",
+					"loggregator_agent.crt": "LOGGREGATOR_AGENT_CERT",
+					"loggregator_agent.key": "LOGGREGATOR_AGENT_KEY",
+				} {
+					content, err := ioutil.ReadFile(path.Join(outputDir, filename))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(content)).To(Equal(contents))
+				}
+			})
+
+			It("passes the same properties from install.ps1", func() {
+				script := generate("ps1")
+				Expect(script).To(ContainSubstring(`('LOGGREGATOR_AGENT_KEY_FILE="{0}"' -f (Join-Path $here 'loggregator_agent.key'))`))
+				Expect(script).To(ContainSubstring(`'LOGGREGATOR_AGENT_GRPC_PORT="3459"'`))
+			})
+		})
+
+		Context("when the rep talks to Locket", func() {
+			generate := func(format string, opsFiles ...string) *gexec.Session {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				args := []string{
+					"-manifest", "two_point_oh_job_properties_manifest.yml",
+					"-outputDir", outputDir,
+					"-machineIp", "10.10.3.21",
+					"-format", format,
+				}
+				for _, opsFile := range opsFiles {
+					args = append(args, "-ops-file", opsFile)
+				}
+				return StartGeneratorWithArgs(args...)
+			}
+
+			It("passes the Locket address and client certs to the Diego MSI", func() {
+				session = generate("bat", "locket_ops.yml")
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(ContainSubstring(strings.Join([]string{
+					`  REP_REQUIRE_TLS=false ^`,
+					`  LOCKET_API_LOCATION=locket.service.cf.internal:8891 ^`,
+					`  LOCKET_CA_FILE=%~dp0\locket_ca.crt ^`,
+					`  LOCKET_CLIENT_CERT_FILE=%~dp0\locket_client.crt ^`,
+					`  LOCKET_CLIENT_KEY_FILE=%~dp0\locket_client.key ^`,
+					`  CONSUL_DOMAIN=cf.internal ^`,
+				}, "\r\n")))
+
+				for filename, contents := range map[string]string{
+					"locket_ca.crt":     "LOCKET_CA_CERT",
+					"locket_client.crt": "LOCKET_CLIENT_CERT",
+					"locket_client.key": "LOCKET_CLIENT_KEY",
+				} {
+					content, err := ioutil.ReadFile(path.Join(outputDir, filename))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(content)).To(Equal(contents))
+				}
+			})
+
+			It("includes the Locket properties in install.json", func() {
+				session = generate("json", "locket_ops.yml")
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var description struct {
+					Msis []struct {
+						Properties map[string]string `json:"properties"`
+					} `json:"msis"`
+				}
+				Expect(json.Unmarshal(content, &description)).To(Succeed())
+				Expect(description.Msis[0].Properties).To(HaveKeyWithValue("LOCKET_API_LOCATION", "locket.service.cf.internal:8891"))
+				Expect(description.Msis[0].Properties).To(HaveKeyWithValue("LOCKET_CLIENT_KEY_FILE", "locket_client.key"))
+			})
+
+			It("reports a missing client key", func() {
+				session = generate("bat", "locket_ops.yml", "locket_missing_key_ops.yml")
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say("diego.locket.client_key"))
+			})
+		})
+
+		Context("when the manifest has several cell instance groups", func() {
+			generate := func(args ...string) *gexec.Session {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				return StartGeneratorWithArgs(append([]string{
+					"-manifest", "two_cell_groups_manifest.yml",
+					"-outputDir", outputDir,
+					"-machineIp", "10.10.3.21",
+				}, args...)...)
+			}
+
+			readScript := func() string {
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+				return string(content)
+			}
+
+			It("picks the Windows cell", func() {
+				session = generate()
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(readScript()).To(ContainSubstring("REDUNDANCY_ZONE=windows_zone"))
+			})
+
+			It("picks the instance group given by -instanceGroup", func() {
+				session = generate("-instanceGroup", "cell")
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(readScript()).To(ContainSubstring("REDUNDANCY_ZONE=linux_zone"))
+			})
+
+			It("lists the cell instance groups when -instanceGroup is not one of them", func() {
+				session = generate("-instanceGroup", "database")
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say("no instance group named database has diego.rep properties"))
+				Expect(session.Err).To(gbytes.Say("Use -instanceGroup to select one of:\n  cell\n  windows2012R2_cell\n"))
+			})
+
+			It("lists the cell instance groups when none of them is recognisably Windows", func() {
+				session = generate("-ops-file", "rename_windows_cell_ops.yml")
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say("2 instance groups have diego.rep properties"))
+				Expect(session.Err).To(gbytes.Say("Use -instanceGroup to select one of:\n  cell\n  cell_z2\n"))
+			})
+		})
+
+		Context("with an explicit zone", func() {
+			It("overrides the zone from the manifest", func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-manifest", manifestYaml,
+					"-outputDir", outputDir,
+					"-zone", "windows-z2",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectedContent := ExpectedContent(models.InstallerArguments{
+					ConsulRequireSSL: true,
+					SyslogHostIP:     "logs2.test.com",
+					BbsRequireSsl:    true,
+					ConsulDomain:     "cf.internal",
+					Zone:             "windows-z2",
+				})
+				Expect(strings.TrimSpace(string(content))).To(Equal(expectedContent))
+			})
+		})
+
+		Context("when selecting the stack", func() {
+			var script string
+
+			run := func(args ...string) {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(append([]string{
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", outputDir,
+				}, args...)...)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+				script = string(content)
+			}
+
+			It("derives the stack from the rep's preloaded rootfses", func() {
+				run("-ops-file", "windows2016_rootfs_ops.yml")
+				Expect(script).To(ContainSubstring("STACK=windows2016 ^"))
+			})
+
+			It("uses -stack when given", func() {
+				run("-ops-file", "windows2016_rootfs_ops.yml", "-stack", "windows")
+				Expect(script).To(ContainSubstring("STACK=windows ^"))
+			})
+
+			It("shows the stack in the dry-run output", func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-dry-run",
+					"-stack", "windows2016",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).Should(gbytes.Say("Stack: windows2016"))
+			})
+		})
+
 		Context("with an optional machine IP", func() {
 			JustBeforeEach(func() {
 				var session *gexec.Session
@@ -722,6 +1940,37 @@ var _ = Describe("Generate", func() {
 			It("displays the reponse error to the user", func() {
 				Expect(session.Err).Should(gbytes.Say("BOSH Director does not have exactly one deployment containing a cf and diego release."))
 			})
+
+			It("lists the candidate deployments and their releases", func() {
+				Expect(session.Err).Should(gbytes.Say("Use -deployment to select one of:"))
+				Expect(session.Err).Should(gbytes.Say(`cf-warden-diego \(cf/213\+dev.2, diego/0.1366.0\+dev.2, garden-runc/1.0.3\)`))
+				Expect(session.Err).Should(gbytes.Say(`cf-warden-diego-2 \(cf/213\+dev.2, diego/0.1366.0\+dev.2, garden-runc/1.0.3\)`))
+			})
+		})
+
+		Context("when the requested deployment does not exist", func() {
+			var server *ghttp.Server
+			var session *gexec.Session
+
+			BeforeEach(func() {
+				var err error
+				server = CreateServer("one_zone_manifest.yml", DefaultIndexDeployment())
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				session = StartGeneratorWithArgs(
+					"-boshUrl", serverUrl(server),
+					"-outputDir", outputDir,
+					"-deployment", "missing",
+				)
+				Eventually(session).Should(gexec.Exit(1))
+			})
+
+			It("lists the available deployments", func() {
+				Expect(session.Err).Should(gbytes.Say("BOSH Director does not have a deployment named missing"))
+				Expect(session.Err).Should(gbytes.Say("cf-warden "))
+				Expect(session.Err).Should(gbytes.Say("cf-warden-diego "))
+				Expect(session.Err).Should(gbytes.Say("diego-vizzini "))
+			})
 		})
 
 		Context("when ran without params", func() {
@@ -736,6 +1985,64 @@ var _ = Describe("Generate", func() {
 			})
 		})
 
+		Context("when an unknown stack is requested", func() {
+			var session *gexec.Session
+			BeforeEach(func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", os.TempDir(),
+					"-stack", "cflinuxfs2",
+				)
+			})
+
+			It("prints the known stacks", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("unknown stack cflinuxfs2, expected one of windows2012R2, windows2016, windows"))
+			})
+		})
+
+		Context("when an unknown format is requested", func() {
+			var session *gexec.Session
+			BeforeEach(func() {
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", os.TempDir(),
+					"-format", "exe",
+				)
+			})
+
+			It("prints an error message", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("unknown format exe"))
+			})
+		})
+
+		Context("when certificate validation fails", func() {
+			var session *gexec.Session
+			var bundleDir string
+			BeforeEach(func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				bundleDir = path.Join(outputDir, "bundle")
+
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", bundleDir,
+					"-skipCertValidation=false",
+				)
+			})
+
+			It("reports every invalid file and writes nothing", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("Error: bbs_ca.crt: no PEM encoded certificate found"))
+				Expect(session.Err).Should(gbytes.Say("Error: bbs_client.crt: no PEM encoded certificate found"))
+				Expect(session.Err).Should(gbytes.Say("Error: consul_agent.crt: no PEM encoded certificate found"))
+				_, err := os.Stat(bundleDir)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
 		Context("when no consul servers are found in the manifest", func() {
 			var server *ghttp.Server
 			var session *gexec.Session
@@ -747,7 +2054,39 @@ var _ = Describe("Generate", func() {
 			})
 
 			It("displays an error to the user", func() {
-				Expect(session.Err).Should(gbytes.Say("Could not find any Consul VMs in your BOSH deployment"))
+				Expect(session.Err).Should(gbytes.Say("the manifest is missing the following properties:"))
+				Expect(session.Err).Should(gbytes.Say("consul.agent.servers.lan"))
+			})
+		})
+
+		Context("when a certificate is empty", func() {
+			It("reports it with -skipCertValidation and writes nothing", func() {
+				var err error
+				outputDir, err = ioutil.TempDir("", "XXXXXXX")
+				Expect(err).NotTo(HaveOccurred())
+				bundleDir := path.Join(outputDir, "bundle")
+				session := StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-ops-file", "empty_bbs_cert_ops.yml",
+					"-outputDir", bundleDir,
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say(`Error: bbs_client.crt: is empty \(read from global properties /properties/diego/rep/bbs/client_cert\)`))
+				_, err = os.Stat(bundleDir)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Context("when the rep job has no bbs properties", func() {
+			It("reports only the bbs properties as missing", func() {
+				session := StartGeneratorWithArgs(
+					"validate",
+					"-manifest", "no_consul_manifest.yml",
+					"-ops-file", "remove_global_diego_ops.yml",
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(string(session.Err.Contents())).To(ContainSubstring("  diego.rep.bbs\n"))
+				Expect(string(session.Err.Contents())).NotTo(ContainSubstring("  diego.rep\n"))
 			})
 		})
 	})
@@ -772,4 +2111,124 @@ var _ = Describe("Generate", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 	})
+
+	Context("file permissions", func() {
+		var bundleDir string
+
+		BeforeEach(func() {
+			if runtime.GOOS == "windows" {
+				Skip("unix file permissions")
+			}
+			var err error
+			outputDir, err = ioutil.TempDir("", "XXXXXXX")
+			Expect(err).NotTo(HaveOccurred())
+			bundleDir = path.Join(outputDir, "bundle")
+			session = StartGeneratorWithArgs(
+				"-manifest", "syslog_manifest.yml",
+				"-outputDir", bundleDir,
+			)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		expectMode := func(filename string, mode os.FileMode) {
+			info, err := os.Stat(path.Join(bundleDir, filename))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(mode), filename)
+		}
+
+		It("creates the output directory readable only by the user", func() {
+			info, err := os.Stat(bundleDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+		})
+
+		It("writes private keys and secrets readable only by the user", func() {
+			expectMode("bbs_client.key", 0600)
+			expectMode("consul_agent.key", 0600)
+			expectMode("consul_encrypt.key", 0600)
+			expectMode("install.bat", 0600)
+		})
+
+		It("writes certificates readable by everyone", func() {
+			expectMode("bbs_ca.crt", 0644)
+			expectMode("bbs_client.crt", 0644)
+			expectMode("consul_agent.crt", 0644)
+		})
+
+		Context("when the files are left over from a previous run", func() {
+			BeforeEach(func() {
+				Expect(os.Chmod(bundleDir, 0755)).To(Succeed())
+				Expect(os.Chmod(path.Join(bundleDir, "bbs_client.key"), 0644)).To(Succeed())
+				session = StartGeneratorWithArgs(
+					"-manifest", "syslog_manifest.yml",
+					"-outputDir", bundleDir,
+				)
+				Eventually(session).Should(gexec.Exit(0))
+			})
+
+			It("makes them readable only by the user again", func() {
+				info, err := os.Stat(bundleDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+				expectMode("bbs_client.key", 0600)
+			})
+		})
+	})
+	Describe("commands", func() {
+		It("runs generate when the command is given explicitly", func() {
+			var err error
+			outputDir, err = ioutil.TempDir("", "XXXXXXX")
+			Expect(err).NotTo(HaveOccurred())
+			session = StartGeneratorWithArgs("generate", "-manifest", "syslog_manifest.yml", "-outputDir", outputDir, "-machineIp", "10.10.3.21")
+			Eventually(session).Should(gexec.Exit(0))
+
+			_, err = os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("lists the commands when an unknown one is given", func() {
+			session = StartGeneratorWithArgs("frobnicate")
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("unknown command frobnicate"))
+			Expect(session.Err).Should(gbytes.Say("Usage of generate:"))
+			Expect(session.Err).Should(gbytes.Say("list-deployments"))
+		})
+
+		Context("validate", func() {
+			It("checks the manifest without writing anything", func() {
+				session = StartGeneratorWithArgs("validate", "-manifest", "syslog_manifest.yml")
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("Validating certificates for a windows2012R2 cell"))
+				Expect(session.Err).Should(gbytes.Say("Error: bbs_ca.crt: no PEM encoded certificate found"))
+			})
+
+			It("reports missing properties", func() {
+				session = StartGeneratorWithArgs("validate", "-manifest", "no_consul_manifest.yml")
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("the manifest is missing the following properties"))
+			})
+		})
+
+		Context("inspect", func() {
+			It("prints each value and where it came from", func() {
+				session = StartGeneratorWithArgs("inspect", "-manifest", "syslog_manifest.yml", "-stack", "windows2016")
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).Should(gbytes.Say(`FIELD\s+VALUE\s+SOURCE`))
+				Expect(session.Out).Should(gbytes.Say(`ConsulIPs\s+127.0.0.1\s+global properties /properties/consul/agent/servers/lan`))
+				Expect(session.Out).Should(gbytes.Say(`Zone\s+zone1\s+job 0 /jobs/0/properties/diego/rep/zone`))
+				Expect(session.Out).Should(gbytes.Say(`Stack\s+windows2016\s+-stack`))
+				Expect(session.Out).Should(gbytes.Say(`SharedSecret\s+<redacted>\s+global properties /properties/metron_endpoint/shared_secret`))
+			})
+		})
+
+		Context("list-deployments", func() {
+			It("prints the deployments and their releases", func() {
+				session = StartGeneratorWithArgs("list-deployments", "-boshUrl", serverUrl(server))
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).Should(gbytes.Say(`NAME\s+RELEASES\s+DIEGO`))
+				Expect(session.Out).Should(gbytes.Say(`cf-warden\s+cf/\S+\s*\n`))
+				Expect(session.Out).Should(gbytes.Say(`cf-warden-diego\s+.*diego/.*\s+yes`))
+			})
+		})
+	})
 })
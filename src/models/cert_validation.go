@@ -0,0 +1,225 @@
+package models
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CertProblem describes an issue with one of the files in
+// InstallerArguments.Certs. Warnings do not prevent the cell from starting.
+type CertProblem struct {
+	Filename string
+	Message  string
+	Warning  bool
+}
+
+func (p CertProblem) Error() string {
+	return p.Filename + ": " + p.Message
+}
+
+// EmptyCerts reports every certificate, CA and private key in certs that has
+// no contents. Unlike ValidateCerts it does not parse them.
+func EmptyCerts(certs map[string]Cert) []CertProblem {
+	problems := []CertProblem{}
+	for _, filename := range sortedFilenames(certs) {
+		cert := certs[filename]
+		if cert.Kind != Secret && cert.Contents == "" {
+			problems = append(problems, CertProblem{Filename: filename, Message: "is empty"})
+		}
+	}
+	return problems
+}
+
+// ValidateCerts parses every certificate and private key in certs, checks
+// that each certificate chains to the CA in its group, through any
+// intermediates that follow it in its file, and that each private key
+// matches the certificate in its group. Certificates that expire
+// within expiryWarning of now are reported as warnings.
+func ValidateCerts(certs map[string]Cert, now time.Time, expiryWarning time.Duration) []CertProblem {
+	problems := []CertProblem{}
+	parsed := map[string][]*x509.Certificate{}
+	parsedKeys := map[string]bool{}
+
+	filenames := sortedFilenames(certs)
+	for _, filename := range filenames {
+		cert := certs[filename]
+		if cert.Kind == PrivateKey {
+			err := parsePrivateKey(cert.Contents)
+			if err != nil {
+				problems = append(problems, CertProblem{Filename: filename, Message: err.Error()})
+			} else {
+				parsedKeys[filename] = true
+			}
+			continue
+		}
+		if cert.Kind != CACert && cert.Kind != Certificate {
+			continue
+		}
+
+		x509Certs, err := parseCertificates(cert.Contents)
+		if err != nil {
+			problems = append(problems, CertProblem{Filename: filename, Message: err.Error()})
+			continue
+		}
+		parsed[filename] = x509Certs
+
+		for _, x509Cert := range x509Certs {
+			if now.After(x509Cert.NotAfter) {
+				problems = append(problems, CertProblem{
+					Filename: filename,
+					Message:  fmt.Sprintf("%s expired on %s", x509Cert.Subject.CommonName, x509Cert.NotAfter.Format(time.RFC3339)),
+				})
+			} else if now.Add(expiryWarning).After(x509Cert.NotAfter) {
+				problems = append(problems, CertProblem{
+					Filename: filename,
+					Message:  fmt.Sprintf("%s expires on %s", x509Cert.Subject.CommonName, x509Cert.NotAfter.Format(time.RFC3339)),
+					Warning:  true,
+				})
+			}
+		}
+	}
+
+	for _, filename := range filenames {
+		cert := certs[filename]
+		switch cert.Kind {
+		case Certificate:
+			caFilename, ok := findInGroup(certs, cert.Group, CACert)
+			if !ok || parsed[filename] == nil || parsed[caFilename] == nil {
+				continue
+			}
+			if !chainsTo(parsed[filename], parsed[caFilename], now) {
+				problems = append(problems, CertProblem{
+					Filename: filename,
+					Message:  "is not signed by " + caFilename,
+				})
+			}
+
+		case PrivateKey:
+			certFilename, ok := findInGroup(certs, cert.Group, Certificate)
+			if !ok || parsed[certFilename] == nil || !parsedKeys[filename] {
+				continue
+			}
+			_, err := tls.X509KeyPair([]byte(certs[certFilename].Contents), []byte(cert.Contents))
+			if err != nil {
+				problems = append(problems, CertProblem{
+					Filename: filename,
+					Message:  fmt.Sprintf("does not match %s: %s", certFilename, err),
+				})
+			}
+		}
+	}
+
+	return problems
+}
+
+// Certificates parses the PEM encoded certificates in c.Contents.
+func (c Cert) Certificates() ([]*x509.Certificate, error) {
+	return parseCertificates(c.Contents)
+}
+
+func parseCertificates(contents string) ([]*x509.Certificate, error) {
+	if contents == "" {
+		return nil, fmt.Errorf("is empty")
+	}
+
+	certs := []*x509.Certificate{}
+	rest := []byte(contents)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
+
+// parsePrivateKey checks that contents holds a PEM encoded PKCS #1, PKCS #8
+// or EC private key.
+func parsePrivateKey(contents string) error {
+	if contents == "" {
+		return fmt.Errorf("is empty")
+	}
+
+	rest := []byte(contents)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return fmt.Errorf("no PEM encoded private key found")
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return nil
+		}
+		if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			return nil
+		}
+		if _, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+			return nil
+		}
+		return fmt.Errorf("%s is not a valid private key", block.Type)
+	}
+}
+
+func sortedFilenames(certs map[string]Cert) []string {
+	filenames := []string{}
+	for filename := range certs {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+func findInGroup(certs map[string]Cert, group string, kind CertKind) (string, bool) {
+	for filename, cert := range certs {
+		if cert.Group == group && cert.Kind == kind {
+			return filename, true
+		}
+	}
+	return "", false
+}
+
+// chainsTo reports whether the first of certs can be verified against cas,
+// using the rest of certs as intermediates. Expiry is reported separately by
+// ValidateCerts, so an expired chain still counts.
+func chainsTo(certs, cas []*x509.Certificate, now time.Time) bool {
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range certs[1:] {
+		intermediates.AddCert(intermediate)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if invalid, ok := err.(x509.CertificateInvalidError); ok && invalid.Reason == x509.Expired {
+		return true
+	}
+	return err == nil
+}
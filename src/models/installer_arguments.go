@@ -4,12 +4,33 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
-	"os"
 	"strings"
 
 	"golang.org/x/crypto/pbkdf2"
 )
 
+// ErrMissingProperty is returned by the Fill* methods when a property they
+// need is present in neither the rep job nor the global manifest properties.
+type ErrMissingProperty struct {
+	Path string
+}
+
+func (e ErrMissingProperty) Error() string {
+	return "missing manifest property " + e.Path
+}
+
+// KnownStacks are the Windows stacks a cell can be installed with.
+var KnownStacks = []string{"windows2012R2", "windows2016", "windows"}
+
+func IsKnownStack(stack string) bool {
+	for _, known := range KnownStacks {
+		if stack == known {
+			return true
+		}
+	}
+	return false
+}
+
 type InstallerArguments struct {
 	repJob            *Job
 	consulJob         *Job
@@ -17,7 +38,9 @@ type InstallerArguments struct {
 	ConsulRequireSSL  bool
 	ConsulIPs         string
 	EtcdCluster       string
+	EtcdRequireSSL    bool
 	Zone              string
+	Stack             string
 	SharedSecret      string
 	Username          string
 	Password          string
@@ -29,75 +52,164 @@ type InstallerArguments struct {
 	MachineIp         string
 	MetronPreferTLS   bool
 	ConsulDomain      string
-	Certs             map[string]string
+	Certs             map[string]Cert
+	// LoggregatorAgent is set when the cell runs the Loggregator v2 agent,
+	// which listens for gRPC on LoggregatorAgentGrpcPort.
+	LoggregatorAgent         bool
+	LoggregatorAgentGrpcPort int
+	// LocketApiLocation is the host:port the rep reaches Locket on over
+	// mutual TLS. It is empty for deployments without Locket.
+	LocketApiLocation string
+	// Sources maps the name of each field set by a Fill* method to the part
+	// of the manifest it was read from.
+	Sources map[string]Source
 }
 
-func NewInstallerArguments(manifest *Manifest) (*InstallerArguments, error) {
-	firstRepJob, err := manifest.FirstRepJob()
+// NewInstallerArguments reads the cell's properties from the rep job
+// selected by Manifest.RepJob(instanceGroup).
+func NewInstallerArguments(manifest *Manifest, instanceGroup string) (*InstallerArguments, error) {
+	repJob, err := manifest.RepJob(instanceGroup)
 	if err != nil {
 		return nil, err
 	}
 	firstConsulJob, _ := manifest.FirstConsulJob()
 	return &InstallerArguments{
-		repJob:    firstRepJob,
+		repJob:    repJob,
 		consulJob: firstConsulJob,
 		manifest:  manifest,
-		Certs:     make(map[string]string),
+		Certs:     make(map[string]Cert),
+		Sources:   make(map[string]Source),
 	}, nil
 }
 
-func (a *InstallerArguments) FillSharedSecret() {
-	properties := a.repJob.Properties
-	if properties.MetronEndpoint == nil && properties.LoggregatorEndpoint == nil {
-		properties = a.manifest.Properties
+// lookup returns the first properties that has accepts, looking in the rep
+// job's named jobs, then the rep job and then the global properties. Each
+// property is looked up on its own, so it is read from the most specific
+// place that sets it.
+func (a *InstallerArguments) lookup(has func(*Properties) bool, names ...string) *Properties {
+	if properties := a.repJob.FindProperties(has, names...); properties != nil {
+		return properties
 	}
-	if properties.MetronEndpoint != nil {
+	if has(a.manifest.Properties) {
+		return a.manifest.Properties
+	}
+	return nil
+}
+
+func (a *InstallerArguments) FillSharedSecret() error {
+	if properties := a.lookup(hasMetronEndpoint, MetronAgentJobName, LoggregatorAgentJobName); properties != nil {
 		a.SharedSecret = properties.MetronEndpoint.SharedSecret
-	} else if properties.LoggregatorEndpoint != nil {
+		a.setSource("SharedSecret", properties, "metron_endpoint.shared_secret")
+	} else if properties := a.lookup(hasLoggregatorEndpoint, MetronAgentJobName, LoggregatorAgentJobName); properties != nil {
 		a.SharedSecret = properties.LoggregatorEndpoint.SharedSecret
+		a.setSource("SharedSecret", properties, "loggregator_endpoint.shared_secret")
 	}
+	return nil
+}
+
+func hasMetronEndpoint(properties *Properties) bool {
+	return properties != nil && properties.MetronEndpoint != nil
 }
 
-func (a *InstallerArguments) FillMetronAgent() {
-	properties := a.repJob.Properties
+func hasLoggregatorEndpoint(properties *Properties) bool {
+	return properties != nil && properties.LoggregatorEndpoint != nil
+}
 
-	if properties.MetronAgent == nil || properties.MetronAgent.PreferredProtocol == nil {
-		properties = a.manifest.Properties
+func (a *InstallerArguments) FillMetronAgent() error {
+	agent := a.lookup(hasPreferredProtocol, MetronAgentJobName)
+	if agent == nil {
+		return nil
+	}
+	properties := a.lookup(hasLoggregator, MetronAgentJobName)
+	if properties == nil {
+		return ErrMissingProperty{Path: "loggregator.tls"}
 	}
 
-	if properties != nil && properties.MetronAgent != nil && properties.MetronAgent.PreferredProtocol != nil {
-		if properties.Loggregator.Tls.Metron.Cert != "" {
-			a.MetronPreferTLS = true
-			a.Certs["metron_agent.crt"] = properties.Loggregator.Tls.Metron.Cert
-			a.Certs["metron_agent.key"] = properties.Loggregator.Tls.Metron.Key
-			a.Certs["metron_ca.crt"] = properties.Loggregator.Tls.CACert
-		} else if *properties.MetronAgent.PreferredProtocol == "tls" {
-			a.MetronPreferTLS = true
-			if properties.Loggregator.Tls.CACert != "" {
-				a.Certs["metron_agent.crt"] = properties.MetronAgent.Tls.ClientCert
-				a.Certs["metron_agent.key"] = properties.MetronAgent.Tls.ClientKey
-				a.Certs["metron_ca.crt"] = properties.Loggregator.Tls.CACert
-			} else {
-				a.Certs["metron_agent.crt"] = properties.MetronAgent.TlsClient.Cert
-				a.Certs["metron_agent.key"] = properties.MetronAgent.TlsClient.Key
-				a.Certs["metron_ca.crt"] = properties.Loggregator.Tls.CA
-			}
+	if properties.Loggregator.Tls.Metron.Cert != "" {
+		a.MetronPreferTLS = true
+		a.setSource("MetronPreferTLS", properties, "loggregator.tls.metron.cert")
+		a.setCert("metron_agent.crt", Cert{Group: "metron", Contents: properties.Loggregator.Tls.Metron.Cert, Kind: Certificate}, properties, "loggregator.tls.metron.cert")
+		a.setCert("metron_agent.key", Cert{Group: "metron", Contents: properties.Loggregator.Tls.Metron.Key, Kind: PrivateKey}, properties, "loggregator.tls.metron.key")
+		a.setCert("metron_ca.crt", Cert{Group: "metron", Contents: properties.Loggregator.Tls.CACert, Kind: CACert}, properties, "loggregator.tls.ca_cert")
+	} else if *agent.MetronAgent.PreferredProtocol == "tls" {
+		a.MetronPreferTLS = true
+		a.setSource("MetronPreferTLS", agent, "metron_agent.preferred_protocol")
+		if properties.Loggregator.Tls.CACert != "" {
+			a.setCert("metron_agent.crt", Cert{Group: "metron", Contents: agent.MetronAgent.Tls.ClientCert, Kind: Certificate}, agent, "metron_agent.tls.client_cert")
+			a.setCert("metron_agent.key", Cert{Group: "metron", Contents: agent.MetronAgent.Tls.ClientKey, Kind: PrivateKey}, agent, "metron_agent.tls.client_key")
+			a.setCert("metron_ca.crt", Cert{Group: "metron", Contents: properties.Loggregator.Tls.CACert, Kind: CACert}, properties, "loggregator.tls.ca_cert")
+		} else {
+			a.setCert("metron_agent.crt", Cert{Group: "metron", Contents: agent.MetronAgent.TlsClient.Cert, Kind: Certificate}, agent, "metron_agent.tls_client.cert")
+			a.setCert("metron_agent.key", Cert{Group: "metron", Contents: agent.MetronAgent.TlsClient.Key, Kind: PrivateKey}, agent, "metron_agent.tls_client.key")
+			a.setCert("metron_ca.crt", Cert{Group: "metron", Contents: properties.Loggregator.Tls.CA, Kind: CACert}, properties, "loggregator.tls.ca")
 		}
 	}
+	return nil
 }
 
-func (a *InstallerArguments) FillSyslog() {
-	properties := a.repJob.Properties
-	if properties.Syslog == nil && a.manifest.Properties != nil {
-		properties = a.manifest.Properties
+func hasPreferredProtocol(properties *Properties) bool {
+	return properties != nil && properties.MetronAgent != nil && properties.MetronAgent.PreferredProtocol != nil
+}
+
+func hasLoggregator(properties *Properties) bool {
+	return properties != nil && properties.Loggregator != nil
+}
+
+// FillLoggregatorAgent reads the Loggregator v2 agent's certs from
+// loggregator.tls.agent. It does nothing for deployments that still run
+// metron_agent, which FillMetronAgent handles.
+func (a *InstallerArguments) FillLoggregatorAgent() error {
+	properties := a.lookup(hasAgentTLS, LoggregatorAgentJobName)
+	if properties == nil {
+		return nil
+	}
+	tls := properties.Loggregator.Tls
+	if tls.CACert == "" {
+		return ErrMissingProperty{Path: "loggregator.tls.ca_cert"}
+	}
+	if tls.Agent.Key == "" {
+		return ErrMissingProperty{Path: "loggregator.tls.agent.key"}
+	}
+
+	a.LoggregatorAgent = true
+	a.setSource("LoggregatorAgent", properties, "loggregator.tls.agent.cert")
+	a.setCert("loggregator_agent.crt", Cert{Group: "loggregator_agent", Contents: tls.Agent.Cert, Kind: Certificate}, properties, "loggregator.tls.agent.cert")
+	a.setCert("loggregator_agent.key", Cert{Group: "loggregator_agent", Contents: tls.Agent.Key, Kind: PrivateKey}, properties, "loggregator.tls.agent.key")
+	a.setCert("loggregator_ca.crt", Cert{Group: "loggregator_agent", Contents: tls.CACert, Kind: CACert}, properties, "loggregator.tls.ca_cert")
+
+	if port := a.lookup(hasGrpcPort, LoggregatorAgentJobName); port != nil {
+		a.LoggregatorAgentGrpcPort = port.GrpcPort
+		a.setSource("LoggregatorAgentGrpcPort", port, "grpc_port")
+	} else {
+		a.LoggregatorAgentGrpcPort = 3458
+		a.Sources["LoggregatorAgentGrpcPort"] = defaultSource
 	}
+	return nil
+}
 
-	if properties.Syslog == nil {
-		return
+func hasAgentTLS(properties *Properties) bool {
+	return hasLoggregator(properties) && properties.Loggregator.Tls.Agent.Cert != ""
+}
+
+func hasGrpcPort(properties *Properties) bool {
+	return properties != nil && properties.GrpcPort != 0
+}
+
+func (a *InstallerArguments) FillSyslog() error {
+	properties := a.lookup(hasSyslog, MetronAgentJobName, LoggregatorAgentJobName)
+	if properties == nil {
+		return nil
 	}
 
 	a.SyslogHostIP = properties.Syslog.Address
 	a.SyslogPort = properties.Syslog.Port
+	a.setSource("SyslogHostIP", properties, "syslog_daemon_config.address")
+	a.setSource("SyslogPort", properties, "syslog_daemon_config.port")
+	return nil
+}
+
+func hasSyslog(properties *Properties) bool {
+	return properties != nil && properties.Syslog != nil
 }
 
 func stringToEncryptKey(str string) string {
@@ -110,76 +222,240 @@ func stringToEncryptKey(str string) string {
 	return base64.StdEncoding.EncodeToString(key)
 }
 
-func (a *InstallerArguments) FillConsul() {
-	properties := a.repJob.Properties
-	if properties.Consul == nil {
-		if a.manifest.Properties != nil {
-			properties = a.manifest.Properties
+func (a *InstallerArguments) FillConsul() error {
+	properties := a.lookup(hasConsul, ConsulAgentJobName)
+	if properties == nil {
+		if a.consulJob == nil {
+			return ErrMissingProperty{Path: "consul"}
 		}
+		properties = a.consulJob.FindProperties(hasConsul, ConsulAgentJobName)
 	}
-	if properties.Consul == nil {
-		properties.Consul = a.consulJob.Properties.Consul
-	}
+	consul := properties.Consul
 
-	consuls := properties.Consul.Agent.Servers.Lan
+	consuls := consul.Agent.Servers.Lan
 
 	if len(consuls) == 0 {
-		fmt.Fprintf(os.Stderr, "Could not find any Consul VMs in your BOSH deployment")
-		os.Exit(1)
+		return ErrMissingProperty{Path: "consul.agent.servers.lan"}
 	}
 
 	a.ConsulIPs = strings.Join(consuls, ",")
+	a.setSource("ConsulIPs", properties, "consul.agent.servers.lan")
 
 	// missing requireSSL implies true
-	requireSSL := properties.Consul.RequireSSL
+	requireSSL := consul.RequireSSL
 	if requireSSL == nil || *requireSSL != "false" {
+		if len(consul.EncryptKeys) == 0 {
+			return ErrMissingProperty{Path: "consul.encrypt_keys"}
+		}
 		a.ConsulRequireSSL = true
-		encryptKey := stringToEncryptKey(properties.Consul.EncryptKeys[0])
+		encryptKey := stringToEncryptKey(consul.EncryptKeys[0])
 
-		a.Certs["consul_agent.crt"] = properties.Consul.AgentCert
-		a.Certs["consul_agent.key"] = properties.Consul.AgentKey
-		a.Certs["consul_ca.crt"] = properties.Consul.CACert
-		a.Certs["consul_encrypt.key"] = encryptKey
+		a.setCert("consul_agent.crt", Cert{Group: "consul", Contents: consul.AgentCert, Kind: Certificate}, properties, "consul.agent_cert")
+		a.setCert("consul_agent.key", Cert{Group: "consul", Contents: consul.AgentKey, Kind: PrivateKey}, properties, "consul.agent_key")
+		a.setCert("consul_ca.crt", Cert{Group: "consul", Contents: consul.CACert, Kind: CACert}, properties, "consul.ca_cert")
+		a.setCert("consul_encrypt.key", Cert{Group: "consul", Contents: encryptKey, Kind: Secret}, properties, "consul.encrypt_keys.0")
+	}
+	if requireSSL == nil {
+		a.Sources["ConsulRequireSSL"] = defaultSource
+	} else {
+		a.setSource("ConsulRequireSSL", properties, "consul.require_ssl")
 	}
 
-	if properties.Consul.Agent.Domain != "" {
-		a.ConsulDomain = properties.Consul.Agent.Domain
+	if consul.Agent.Domain != "" {
+		a.ConsulDomain = consul.Agent.Domain
+		a.setSource("ConsulDomain", properties, "consul.agent.domain")
 	} else {
 		a.ConsulDomain = "cf.internal"
+		a.Sources["ConsulDomain"] = defaultSource
 	}
+	return nil
+}
+
+// FillEtcd builds the etcd cluster URLs from loggregator.etcd.machines. The
+// cluster is left empty for deployments that no longer run etcd.
+func (a *InstallerArguments) FillEtcd() error {
+	properties := a.lookup(hasEtcdMachines, MetronAgentJobName)
+	if properties == nil {
+		return nil
+	}
+	etcd := properties.Loggregator.Etcd
+
+	scheme := "http"
+	if etcd.RequireSSL != nil {
+		a.setSource("EtcdRequireSSL", properties, "loggregator.etcd.require_ssl")
+	} else {
+		a.Sources["EtcdRequireSSL"] = defaultSource
+	}
+	if etcd.RequireSSL != nil && *etcd.RequireSSL {
+		client := a.lookup(hasEtcdClient, MetronAgentJobName)
+		if client == nil {
+			return ErrMissingProperty{Path: "etcd.client_cert"}
+		}
+		scheme = "https"
+		a.EtcdRequireSSL = true
+		a.setCert("etcd_ca.crt", Cert{Group: "etcd", Contents: etcd.CACert, Kind: CACert}, properties, "loggregator.etcd.ca_cert")
+		a.setCert("etcd_client.crt", Cert{Group: "etcd", Contents: client.Etcd.ClientCert, Kind: Certificate}, client, "etcd.client_cert")
+		a.setCert("etcd_client.key", Cert{Group: "etcd", Contents: client.Etcd.ClientKey, Kind: PrivateKey}, client, "etcd.client_key")
+	}
+
+	port := etcd.Port
+	if port == 0 {
+		port = 4001
+	}
+
+	urls := []string{}
+	for _, machine := range etcd.Machines {
+		urls = append(urls, fmt.Sprintf("%s://%s:%d", scheme, machine, port))
+	}
+	a.EtcdCluster = strings.Join(urls, ",")
+	a.setSource("EtcdCluster", properties, "loggregator.etcd.machines")
+	return nil
+}
+
+func hasEtcdMachines(properties *Properties) bool {
+	return hasLoggregator(properties) && len(properties.Loggregator.Etcd.Machines) > 0
+}
+
+func hasEtcdClient(properties *Properties) bool {
+	return properties != nil && properties.Etcd != nil
+}
+
+// FillZone sets the redundancy zone from diego.rep.zone, falling back to the
+// first of the rep instance group's azs and finally to "windows".
+func (a *InstallerArguments) FillZone() error {
+	if properties := a.lookup(hasRepZone, RepJobName); properties != nil {
+		a.Zone = properties.Diego.Rep.Zone
+		a.setSource("Zone", properties, "diego.rep.zone")
+		return nil
+	}
+
+	if len(a.repJob.Azs) > 0 {
+		a.Zone = a.repJob.Azs[0]
+		block, path := a.jobPath(a.repJob)
+		a.Sources["Zone"] = Source{Block: block, Path: path + "/azs/0"}
+	} else {
+		a.Zone = "windows"
+		a.Sources["Zone"] = defaultSource
+	}
+	return nil
+}
+
+// FillStack sets the stack from diego.rep.stack or the first Windows stack in
+// diego.rep.preloaded_rootfses, defaulting to windows2012R2. A diego.rep.stack
+// that is not one of KnownStacks is an error.
+func (a *InstallerArguments) FillStack() error {
+	if properties := a.lookup(hasRepStack, RepJobName); properties != nil {
+		stack := properties.Diego.Rep.Stack
+		if !IsKnownStack(stack) {
+			return fmt.Errorf("unknown stack %s, expected one of %s (read from %s)", stack, strings.Join(KnownStacks, ", "), a.sourceOf(properties, "diego.rep.stack"))
+		}
+		a.Stack = stack
+		a.setSource("Stack", properties, "diego.rep.stack")
+		return nil
+	}
+	if properties := a.lookup(hasWindowsRootfs, RepJobName); properties != nil {
+		i := windowsRootfs(properties)
+		a.Stack = strings.SplitN(properties.Diego.Rep.PreloadedRootfses[i], ":", 2)[0]
+		a.setSource("Stack", properties, fmt.Sprintf("diego.rep.preloaded_rootfses.%d", i))
+		return nil
+	}
+
+	a.Stack = "windows2012R2"
+	a.Sources["Stack"] = defaultSource
+	return nil
 }
 
 func (a *InstallerArguments) FillMachineIp(machineIp string) {
 	a.MachineIp = machineIp
 }
 
-func (a *InstallerArguments) FillBBS() {
-	properties := a.repJob.Properties
-	if properties.Diego.Rep.BBS == nil {
-		properties = a.manifest.Properties
+func (a *InstallerArguments) FillBBS() error {
+	properties := a.lookup(hasRepBBS, RepJobName)
+	if properties == nil {
+		if a.lookup(hasRep, RepJobName) == nil {
+			return ErrMissingProperty{Path: "diego.rep"}
+		}
+		return ErrMissingProperty{Path: "diego.rep.bbs"}
 	}
 
 	requireSSL := properties.Diego.Rep.BBS.RequireSSL
+	if requireSSL == nil {
+		a.Sources["BbsRequireSsl"] = defaultSource
+	} else {
+		a.setSource("BbsRequireSsl", properties, "diego.rep.bbs.require_ssl")
+	}
 	// missing requireSSL implies true
 	if requireSSL == nil || *requireSSL {
 		a.BbsRequireSsl = true
-		a.Certs["bbs_client.crt"] = properties.Diego.Rep.BBS.ClientCert
-		a.Certs["bbs_client.key"] = properties.Diego.Rep.BBS.ClientKey
-		a.Certs["bbs_ca.crt"] = properties.Diego.Rep.BBS.CACert
+		a.setCert("bbs_client.crt", Cert{Group: "bbs", Contents: properties.Diego.Rep.BBS.ClientCert, Kind: Certificate}, properties, "diego.rep.bbs.client_cert")
+		a.setCert("bbs_client.key", Cert{Group: "bbs", Contents: properties.Diego.Rep.BBS.ClientKey, Kind: PrivateKey}, properties, "diego.rep.bbs.client_key")
+		a.setCert("bbs_ca.crt", Cert{Group: "bbs", Contents: properties.Diego.Rep.BBS.CACert, Kind: CACert}, properties, "diego.rep.bbs.ca_cert")
 	}
+	return nil
 }
-func (a *InstallerArguments) FillRep() {
-	properties := a.repJob.Properties
-	if properties.Diego.Rep.BBS == nil {
-		properties = a.manifest.Properties
+
+func (a *InstallerArguments) FillRep() error {
+	if a.lookup(hasRep, RepJobName) == nil {
+		return ErrMissingProperty{Path: "diego.rep"}
+	}
+	properties := a.lookup(hasRepRequireTLS, RepJobName)
+	if properties == nil {
+		a.Sources["RepRequireTls"] = defaultSource
+		return nil
 	}
 
-	requireTLS := properties.Diego.Rep.RequireTls
-	// missing requireTLS implies true
-	if requireTLS != nil && *requireTLS {
+	a.setSource("RepRequireTls", properties, "diego.rep.require_tls")
+	if *properties.Diego.Rep.RequireTls {
 		a.RepRequireTls = true
-		a.Certs["rep_ca.crt"] = properties.Diego.Rep.CACert
-		a.Certs["rep_server.key"] = properties.Diego.Rep.ServerKey
-		a.Certs["rep_server.crt"] = properties.Diego.Rep.ServerCert
+		a.setCert("rep_ca.crt", Cert{Group: "rep", Contents: properties.Diego.Rep.CACert, Kind: CACert}, properties, "diego.rep.ca_cert")
+		a.setCert("rep_server.key", Cert{Group: "rep", Contents: properties.Diego.Rep.ServerKey, Kind: PrivateKey}, properties, "diego.rep.server_key")
+		a.setCert("rep_server.crt", Cert{Group: "rep", Contents: properties.Diego.Rep.ServerCert, Kind: Certificate}, properties, "diego.rep.server_cert")
 	}
+	return nil
+}
+
+// FillLocket reads the Locket address and the rep's Locket client certs from
+// diego.locket. Older deployments without Locket leave it unset.
+func (a *InstallerArguments) FillLocket() error {
+	properties := a.lookup(hasLocket, RepJobName)
+	if properties == nil {
+		return nil
+	}
+	locket := properties.Diego.Locket
+	if locket.CACert == "" {
+		return ErrMissingProperty{Path: "diego.locket.ca_cert"}
+	}
+	if locket.ClientCert == "" {
+		return ErrMissingProperty{Path: "diego.locket.client_cert"}
+	}
+	if locket.ClientKey == "" {
+		return ErrMissingProperty{Path: "diego.locket.client_key"}
+	}
+
+	a.LocketApiLocation = locket.ApiLocation
+	a.setSource("LocketApiLocation", properties, "diego.locket.api_location")
+	a.setCert("locket_ca.crt", Cert{Group: "locket", Contents: locket.CACert, Kind: CACert}, properties, "diego.locket.ca_cert")
+	a.setCert("locket_client.crt", Cert{Group: "locket", Contents: locket.ClientCert, Kind: Certificate}, properties, "diego.locket.client_cert")
+	a.setCert("locket_client.key", Cert{Group: "locket", Contents: locket.ClientKey, Kind: PrivateKey}, properties, "diego.locket.client_key")
+	return nil
+}
+
+func hasLocket(properties *Properties) bool {
+	return properties != nil && properties.Diego != nil && properties.Diego.Locket != nil && properties.Diego.Locket.ApiLocation != ""
+}
+
+func hasRepBBS(properties *Properties) bool {
+	return hasRep(properties) && properties.Diego.Rep.BBS != nil
+}
+
+func hasRepZone(properties *Properties) bool {
+	return hasRep(properties) && properties.Diego.Rep.Zone != ""
+}
+
+func hasRepStack(properties *Properties) bool {
+	return hasRep(properties) && properties.Diego.Rep.Stack != ""
+}
+
+func hasRepRequireTLS(properties *Properties) bool {
+	return hasRep(properties) && properties.Diego.Rep.RequireTls != nil
 }
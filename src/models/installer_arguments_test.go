@@ -36,7 +36,7 @@ var _ = Describe("InstallerArguments", func() {
 					Job{},
 				},
 			}
-			_, err := NewInstallerArguments(&manifest)
+			_, err := NewInstallerArguments(&manifest, "")
 			Expect(err).To(HaveOccurred())
 		})
 	})
@@ -49,7 +49,7 @@ var _ = Describe("InstallerArguments", func() {
 				SharedSecret: sharedSecret,
 			}
 
-			args, err := NewInstallerArguments(&manifest)
+			args, err := NewInstallerArguments(&manifest, "")
 			Expect(err).To(BeNil())
 
 			args.FillSharedSecret()
@@ -61,7 +61,7 @@ var _ = Describe("InstallerArguments", func() {
 				SharedSecret: sharedSecret,
 			}
 
-			args, err := NewInstallerArguments(&manifest)
+			args, err := NewInstallerArguments(&manifest, "")
 			Expect(err).To(BeNil())
 
 			args.FillSharedSecret()
@@ -71,7 +71,7 @@ var _ = Describe("InstallerArguments", func() {
 		It("works when the global properties use the legacy loggregator_endpoint property", func() {
 			manifest.Properties.LoggregatorEndpoint = &MetronEndpoint{SharedSecret: sharedSecret}
 
-			args, err := NewInstallerArguments(&manifest)
+			args, err := NewInstallerArguments(&manifest, "")
 			Expect(err).To(BeNil())
 
 			args.FillSharedSecret()
@@ -81,20 +81,199 @@ var _ = Describe("InstallerArguments", func() {
 		It("works when the global properties use the new metron_endpoint property", func() {
 			manifest.Properties.MetronEndpoint = &MetronEndpoint{SharedSecret: sharedSecret}
 
-			args, err := NewInstallerArguments(&manifest)
+			args, err := NewInstallerArguments(&manifest, "")
 			Expect(err).To(BeNil())
 
 			args.FillSharedSecret()
 			Expect(args.SharedSecret).To(Equal(sharedSecret))
 		})
+
+		It("reads the instance group's property when the metron_agent job sets others", func() {
+			manifest = Manifest{
+				InstanceGroups: []Job{{
+					Name: "windows_cell",
+					Properties: &Properties{
+						Diego:          &DiegoProperties{Rep: &Rep{}},
+						MetronEndpoint: &MetronEndpoint{SharedSecret: sharedSecret},
+					},
+					Jobs: []InstanceGroupJob{
+						{Name: "metron_agent", Properties: &Properties{
+							Syslog: &SyslogProperties{Address: "logs.example.com", Port: "514"},
+						}},
+					},
+				}},
+				Properties: &Properties{MetronEndpoint: &MetronEndpoint{SharedSecret: "global"}},
+			}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillSharedSecret()).To(Succeed())
+			Expect(args.SharedSecret).To(Equal(sharedSecret))
+			Expect(args.Sources["SharedSecret"].Path).To(Equal("/instance_groups/name=windows_cell/properties/metron_endpoint/shared_secret"))
+
+			Expect(args.FillSyslog()).To(Succeed())
+			Expect(args.SyslogHostIP).To(Equal("logs.example.com"))
+			Expect(args.Sources["SyslogHostIP"].Block).To(Equal("instance group windows_cell job metron_agent"))
+		})
+	})
+
+	Describe("FillLoggregatorAgent", func() {
+		BeforeEach(func() {
+			manifest.Properties.Loggregator.Tls = Tls{
+				CACert: "cacert",
+				Agent:  MetronTls{Cert: "agentcert", Key: "agentkey"},
+			}
+		})
+
+		It("copies the agent certs", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLoggregatorAgent()).To(Succeed())
+			Expect(args.LoggregatorAgent).To(BeTrue())
+			Expect(args.Certs["loggregator_agent.crt"]).To(Equal(Cert{
+				Group:    "loggregator_agent",
+				Contents: "agentcert",
+				Kind:     Certificate,
+				Source:   Source{Block: "global properties", Path: "/properties/loggregator/tls/agent/cert"},
+			}))
+			Expect(args.Certs["loggregator_agent.key"].Contents).To(Equal("agentkey"))
+			Expect(args.Certs["loggregator_agent.key"].IsSecret()).To(BeTrue())
+			Expect(args.Certs["loggregator_ca.crt"].Contents).To(Equal("cacert"))
+		})
+
+		It("defaults the gRPC port", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLoggregatorAgent()).To(Succeed())
+			Expect(args.LoggregatorAgentGrpcPort).To(Equal(3458))
+			Expect(args.Sources["LoggregatorAgentGrpcPort"].Block).To(Equal("default"))
+		})
+
+		It("prefers the loggregator_agent job's properties", func() {
+			manifest = Manifest{
+				InstanceGroups: []Job{{
+					Name: "windows_cell",
+					Jobs: []InstanceGroupJob{
+						{Name: "rep", Properties: &Properties{Diego: &DiegoProperties{Rep: &Rep{}}}},
+						{Name: "loggregator_agent", Properties: &Properties{
+							GrpcPort:    3459,
+							Loggregator: &LoggregatorProperties{Tls: Tls{CACert: "jobca", Agent: MetronTls{Cert: "jobcert", Key: "jobkey"}}},
+						}},
+					},
+				}},
+				Properties: manifest.Properties,
+			}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLoggregatorAgent()).To(Succeed())
+			Expect(args.Certs["loggregator_agent.crt"].Contents).To(Equal("jobcert"))
+			Expect(args.LoggregatorAgentGrpcPort).To(Equal(3459))
+			Expect(args.Sources["LoggregatorAgentGrpcPort"].Path).To(Equal("/instance_groups/name=windows_cell/jobs/name=loggregator_agent/properties/grpc_port"))
+		})
+
+		It("returns an error when the agent key is missing", func() {
+			manifest.Properties.Loggregator.Tls.Agent.Key = ""
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLoggregatorAgent()).To(Equal(ErrMissingProperty{Path: "loggregator.tls.agent.key"}))
+		})
+
+		It("does nothing without agent TLS properties", func() {
+			manifest.Properties.Loggregator.Tls = Tls{}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLoggregatorAgent()).To(Succeed())
+			Expect(args.LoggregatorAgent).To(BeFalse())
+			Expect(args.Certs).To(BeEmpty())
+		})
+	})
+
+	Describe("FillLocket", func() {
+		BeforeEach(func() {
+			repJob.Properties.Diego.Locket = &LocketProperties{
+				ApiLocation: "locket.service.cf.internal:8891",
+				CACert:      "locketca",
+				ClientCert:  "locketcert",
+				ClientKey:   "locketkey",
+			}
+			manifest.Jobs = []Job{repJob}
+		})
+
+		It("copies the Locket address and client certs from the rep job", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLocket()).To(Succeed())
+			Expect(args.LocketApiLocation).To(Equal("locket.service.cf.internal:8891"))
+			Expect(args.Certs["locket_ca.crt"].Contents).To(Equal("locketca"))
+			Expect(args.Certs["locket_client.crt"].Contents).To(Equal("locketcert"))
+			Expect(args.Certs["locket_client.key"]).To(Equal(Cert{
+				Group:    "locket",
+				Contents: "locketkey",
+				Kind:     PrivateKey,
+				Source:   Source{Block: "job 0", Path: "/jobs/0/properties/diego/locket/client_key"},
+			}))
+		})
+
+		It("falls back to the global properties", func() {
+			manifest.Properties.Diego = repJob.Properties.Diego
+			repJob.Properties.Diego = &DiegoProperties{Rep: &Rep{}}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLocket()).To(Succeed())
+			Expect(args.Sources["LocketApiLocation"]).To(Equal(Source{Block: "global properties", Path: "/properties/diego/locket/api_location"}))
+		})
+
+		It("returns an error when a client cert is missing", func() {
+			repJob.Properties.Diego.Locket.ClientKey = ""
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLocket()).To(Equal(ErrMissingProperty{Path: "diego.locket.client_key"}))
+		})
+
+		It("does nothing without a Locket address", func() {
+			repJob.Properties.Diego.Locket = nil
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillLocket()).To(Succeed())
+			Expect(args.LocketApiLocation).To(BeEmpty())
+			Expect(args.Certs).To(BeEmpty())
+		})
 	})
 
 	Describe("FillMetronAgent", func() {
+		It("returns an error when the loggregator properties are missing", func() {
+			tls := "tls"
+			manifest.Properties.MetronAgent.PreferredProtocol = &tls
+			manifest.Properties.Loggregator = nil
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			err = args.FillMetronAgent()
+			Expect(err).To(Equal(ErrMissingProperty{Path: "loggregator.tls"}))
+		})
+
 		It("does not copy certs when TLS is not the preferred protocol", func() {
 			tcp := "tcp"
 			manifest.Properties.MetronAgent.PreferredProtocol = &tcp
 
-			args, err := NewInstallerArguments(&manifest)
+			args, err := NewInstallerArguments(&manifest, "")
 			Expect(err).To(BeNil())
 
 			args.FillMetronAgent()
@@ -112,15 +291,32 @@ var _ = Describe("InstallerArguments", func() {
 					Cert: "clientcert",
 				}
 
-				args, err := NewInstallerArguments(&manifest)
+				args, err := NewInstallerArguments(&manifest, "")
 				Expect(err).To(BeNil())
 
 				args.FillMetronAgent()
-				Expect(args.Certs["metron_agent.crt"]).To(Equal("clientcert"))
-				Expect(args.Certs["metron_agent.key"]).To(Equal("clientkey"))
-				Expect(args.Certs["metron_ca.crt"]).To(Equal("cacert"))
+				Expect(args.Certs["metron_agent.crt"].Contents).To(Equal("clientcert"))
+				Expect(args.Certs["metron_agent.key"].Contents).To(Equal("clientkey"))
+				Expect(args.Certs["metron_ca.crt"].Contents).To(Equal("cacert"))
 				Expect(args.MetronPreferTLS).To(BeTrue())
 			})
+
+			It("marks only the private key as secret", func() {
+				tls := "udp"
+				manifest.Properties.MetronAgent.PreferredProtocol = &tls
+				manifest.Properties.Loggregator.Tls.Metron = MetronTls{
+					Key:  "clientkey",
+					Cert: "clientcert",
+				}
+
+				args, err := NewInstallerArguments(&manifest, "")
+				Expect(err).To(BeNil())
+
+				args.FillMetronAgent()
+				Expect(args.Certs["metron_agent.key"].IsSecret()).To(BeTrue())
+				Expect(args.Certs["metron_agent.crt"].IsSecret()).To(BeFalse())
+				Expect(args.Certs["metron_ca.crt"].Kind).To(Equal(CACert))
+			})
 		})
 
 		Context("when metron TLS properties are nested under MetronAgent", func() {
@@ -133,13 +329,13 @@ var _ = Describe("InstallerArguments", func() {
 					ClientCert: "clientcert",
 				}
 
-				args, err := NewInstallerArguments(&manifest)
+				args, err := NewInstallerArguments(&manifest, "")
 				Expect(err).To(BeNil())
 
 				args.FillMetronAgent()
-				Expect(args.Certs["metron_agent.crt"]).To(Equal("clientcert"))
-				Expect(args.Certs["metron_agent.key"]).To(Equal("clientkey"))
-				Expect(args.Certs["metron_ca.crt"]).To(Equal("cacert"))
+				Expect(args.Certs["metron_agent.crt"].Contents).To(Equal("clientcert"))
+				Expect(args.Certs["metron_agent.key"].Contents).To(Equal("clientkey"))
+				Expect(args.Certs["metron_ca.crt"].Contents).To(Equal("cacert"))
 				Expect(args.MetronPreferTLS).To(BeTrue())
 			})
 		})
@@ -154,13 +350,13 @@ var _ = Describe("InstallerArguments", func() {
 					Cert: "clientcert",
 				}
 
-				args, err := NewInstallerArguments(&manifest)
+				args, err := NewInstallerArguments(&manifest, "")
 				Expect(err).To(BeNil())
 
 				args.FillMetronAgent()
-				Expect(args.Certs["metron_agent.crt"]).To(Equal("clientcert"))
-				Expect(args.Certs["metron_agent.key"]).To(Equal("clientkey"))
-				Expect(args.Certs["metron_ca.crt"]).To(Equal("cacert"))
+				Expect(args.Certs["metron_agent.crt"].Contents).To(Equal("clientcert"))
+				Expect(args.Certs["metron_agent.key"].Contents).To(Equal("clientkey"))
+				Expect(args.Certs["metron_ca.crt"].Contents).To(Equal("cacert"))
 				Expect(args.MetronPreferTLS).To(BeTrue())
 			})
 		})
@@ -171,7 +367,7 @@ var _ = Describe("InstallerArguments", func() {
 		const port = "2042"
 
 		It("does not set syslog when the manifest doesnt have syslog", func() {
-			args, err := NewInstallerArguments(&manifest)
+			args, err := NewInstallerArguments(&manifest, "")
 			Expect(err).To(BeNil())
 
 			args.FillSyslog()
@@ -186,7 +382,7 @@ var _ = Describe("InstallerArguments", func() {
 					Port:    port,
 				}
 
-				args, err := NewInstallerArguments(&manifest)
+				args, err := NewInstallerArguments(&manifest, "")
 				Expect(err).To(BeNil())
 
 				args.FillSyslog()
@@ -202,7 +398,7 @@ var _ = Describe("InstallerArguments", func() {
 					Port:    port,
 				}
 
-				args, err := NewInstallerArguments(&manifest)
+				args, err := NewInstallerArguments(&manifest, "")
 				Expect(err).To(BeNil())
 
 				args.FillSyslog()
@@ -211,4 +407,318 @@ var _ = Describe("InstallerArguments", func() {
 			})
 		})
 	})
+
+	Describe("FillConsul", func() {
+		It("returns an error when no consul properties are found", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			err = args.FillConsul()
+			Expect(err).To(Equal(ErrMissingProperty{Path: "consul"}))
+		})
+
+		It("returns an error when no consul servers are found", func() {
+			manifest.Properties.Consul = &ConsulProperties{}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			err = args.FillConsul()
+			Expect(err).To(Equal(ErrMissingProperty{Path: "consul.agent.servers.lan"}))
+		})
+	})
+
+	Describe("FillBBS", func() {
+		It("returns an error when no bbs properties are found", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			err = args.FillBBS()
+			Expect(err).To(Equal(ErrMissingProperty{Path: "diego.rep.bbs"}))
+		})
+
+		It("returns an error when no rep properties are found", func() {
+			manifest.Jobs = []Job{{Jobs: []InstanceGroupJob{{Name: "rep"}}}}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			err = args.FillBBS()
+			Expect(err).To(Equal(ErrMissingProperty{Path: "diego.rep"}))
+		})
+	})
+
+	Describe("FillRep", func() {
+		It("reads the rep job's properties when it has no bbs properties", func() {
+			requireTLS := false
+			repJob.Properties.Diego.Rep.RequireTls = &requireTLS
+			manifest.Properties.Diego = &DiegoProperties{Rep: &Rep{BBS: &BBSProperties{}}}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillRep()).To(Succeed())
+			Expect(args.Sources["RepRequireTls"].Path).To(Equal("/jobs/0/properties/diego/rep/require_tls"))
+		})
+
+		It("returns an error when no rep properties are found", func() {
+			manifest.Jobs = []Job{{Jobs: []InstanceGroupJob{{Name: "rep"}}}}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			err = args.FillRep()
+			Expect(err).To(Equal(ErrMissingProperty{Path: "diego.rep"}))
+		})
+	})
+
+	Describe("FillEtcd", func() {
+		It("leaves the cluster empty when the deployment does not run etcd", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillEtcd()).To(Succeed())
+			Expect(args.EtcdCluster).To(BeEmpty())
+			Expect(args.EtcdRequireSSL).To(BeFalse())
+		})
+
+		It("builds the cluster from loggregator.etcd.machines", func() {
+			manifest.Properties.Loggregator.Etcd.Machines = []string{"etcd-0.example.com", "etcd-1.example.com"}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillEtcd()).To(Succeed())
+			Expect(args.EtcdCluster).To(Equal("http://etcd-0.example.com:4001,http://etcd-1.example.com:4001"))
+			Expect(args.Certs).To(BeEmpty())
+		})
+
+		Context("when etcd requires TLS", func() {
+			BeforeEach(func() {
+				requireSSL := true
+				manifest.Properties.Loggregator.Etcd.Machines = []string{"cf-etcd.service.cf.internal"}
+				manifest.Properties.Loggregator.Etcd.Port = 4002
+				manifest.Properties.Loggregator.Etcd.RequireSSL = &requireSSL
+				manifest.Properties.Loggregator.Etcd.CACert = "etcdca"
+			})
+
+			It("uses https and copies the certs", func() {
+				manifest.Properties.Etcd = &EtcdProperties{
+					ClientCert: "clientcert",
+					ClientKey:  "clientkey",
+				}
+
+				args, err := NewInstallerArguments(&manifest, "")
+				Expect(err).To(BeNil())
+
+				Expect(args.FillEtcd()).To(Succeed())
+				Expect(args.EtcdCluster).To(Equal("https://cf-etcd.service.cf.internal:4002"))
+				Expect(args.EtcdRequireSSL).To(BeTrue())
+				Expect(args.Certs["etcd_ca.crt"].Contents).To(Equal("etcdca"))
+				Expect(args.Certs["etcd_client.crt"].Contents).To(Equal("clientcert"))
+				Expect(args.Certs["etcd_client.key"].Contents).To(Equal("clientkey"))
+			})
+
+			It("returns an error when the client certs are missing", func() {
+				args, err := NewInstallerArguments(&manifest, "")
+				Expect(err).To(BeNil())
+
+				Expect(args.FillEtcd()).To(Equal(ErrMissingProperty{Path: "etcd.client_cert"}))
+			})
+		})
+	})
+
+	Describe("FillZone", func() {
+		It("uses the rep job's zone", func() {
+			repJob.Properties.Diego.Rep.Zone = "z1"
+			repJob.Azs = []string{"z2"}
+			manifest.Jobs = []Job{repJob}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillZone()).To(Succeed())
+			Expect(args.Zone).To(Equal("z1"))
+		})
+
+		It("uses the global rep zone", func() {
+			manifest.Properties.Diego = &DiegoProperties{Rep: &Rep{Zone: "z3"}}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillZone()).To(Succeed())
+			Expect(args.Zone).To(Equal("z3"))
+		})
+
+		It("falls back to the instance group's first az", func() {
+			repJob.Azs = []string{"z2", "z4"}
+			manifest.Jobs = []Job{repJob}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillZone()).To(Succeed())
+			Expect(args.Zone).To(Equal("z2"))
+		})
+
+		It("defaults to windows", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillZone()).To(Succeed())
+			Expect(args.Zone).To(Equal("windows"))
+		})
+	})
+
+	Describe("FillStack", func() {
+		It("uses diego.rep.stack when it is a known stack", func() {
+			repJob.Properties.Diego.Rep.Stack = "windows2016"
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillStack()).To(Succeed())
+			Expect(args.Stack).To(Equal("windows2016"))
+		})
+
+		It("uses the first Windows stack in diego.rep.preloaded_rootfses", func() {
+			repJob.Properties.Diego.Rep.PreloadedRootfses = []string{
+				"cflinuxfs2:/var/vcap/packages/cflinuxfs2/rootfs",
+				"windows:oci:///C:/var/vcap/packages/windowsfs",
+			}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillStack()).To(Succeed())
+			Expect(args.Stack).To(Equal("windows"))
+		})
+
+		It("defaults to windows2012R2", func() {
+			repJob.Properties.Diego.Rep.PreloadedRootfses = []string{"cflinuxfs2:/var/vcap/packages/cflinuxfs2/rootfs"}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillStack()).To(Succeed())
+			Expect(args.Stack).To(Equal("windows2012R2"))
+		})
+
+		It("rejects an unknown diego.rep.stack", func() {
+			repJob.Name = "windows_cell"
+			repJob.Properties.Diego.Rep.Stack = "windows2019"
+			manifest.Jobs = []Job{repJob}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			err = args.FillStack()
+			Expect(err).To(MatchError("unknown stack windows2019, expected one of windows2012R2, windows2016, windows (read from job windows_cell /jobs/name=windows_cell/properties/diego/rep/stack)"))
+		})
+	})
+
+	Describe("Sources", func() {
+		It("records the rep job property a value was read from", func() {
+			repJob.Name = "cell_z1"
+			repJob.Properties.Diego.Rep.Zone = "z1"
+			manifest.Jobs = []Job{repJob}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillZone()).To(Succeed())
+			Expect(args.Sources["Zone"]).To(Equal(Source{Block: "job cell_z1", Path: "/jobs/name=cell_z1/properties/diego/rep/zone"}))
+		})
+
+		It("records values read from the global properties", func() {
+			manifest.Properties.Syslog = &SyslogProperties{Address: "logs.example.com", Port: "514"}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillSyslog()).To(Succeed())
+			Expect(args.Sources["SyslogHostIP"]).To(Equal(Source{Block: "global properties", Path: "/properties/syslog_daemon_config/address"}))
+		})
+
+		It("identifies unnamed instance groups by index", func() {
+			manifest.Jobs = nil
+			manifest.InstanceGroups = []Job{{Name: "router"}, repJob}
+			repJob.Properties.Diego.Rep.Stack = "windows2016"
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillStack()).To(Succeed())
+			Expect(args.Sources["Stack"]).To(Equal(Source{Block: "instance group 1", Path: "/instance_groups/1/properties/diego/rep/stack"}))
+		})
+
+		It("records the consul job when consul properties are read from it", func() {
+			consulJob := Job{
+				Name: "consul_z1",
+				Properties: &Properties{
+					Consul: &ConsulProperties{
+						CACert:      "CONSUL_CA_CERT",
+						EncryptKeys: []string{"key"},
+					},
+				},
+			}
+			consulJob.Properties.Consul.Agent.Servers.Lan = []string{"10.0.0.1"}
+			manifest.Jobs = []Job{repJob, consulJob}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillConsul()).To(Succeed())
+			Expect(args.Sources["ConsulIPs"]).To(Equal(Source{Block: "job consul_z1", Path: "/jobs/name=consul_z1/properties/consul/agent/servers/lan"}))
+			Expect(args.Certs["consul_ca.crt"].Source).To(Equal(Source{Block: "job consul_z1", Path: "/jobs/name=consul_z1/properties/consul/ca_cert"}))
+			Expect(args.Certs["consul_encrypt.key"].Source.Path).To(Equal("/jobs/name=consul_z1/properties/consul/encrypt_keys/0"))
+		})
+
+		It("records the instance group job properties were read from", func() {
+			manifest = Manifest{
+				InstanceGroups: []Job{{
+					Name: "windows_cell",
+					Jobs: []InstanceGroupJob{
+						{Name: "rep", Release: "diego", Properties: &Properties{
+							Diego: &DiegoProperties{Rep: &Rep{Zone: "z1"}},
+						}},
+					},
+				}},
+			}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillZone()).To(Succeed())
+			Expect(args.Sources["Zone"]).To(Equal(Source{
+				Block: "instance group windows_cell job rep",
+				Path:  "/instance_groups/name=windows_cell/jobs/name=rep/properties/diego/rep/zone",
+			}))
+		})
+
+		It("records the property each cert was read from", func() {
+			requireTLS := true
+			repJob.Properties.Diego.Rep.RequireTls = &requireTLS
+			repJob.Properties.Diego.Rep.CACert = "REP_CA_CERT"
+			repJob.Properties.Diego.Rep.BBS = &BBSProperties{}
+			manifest.Jobs = []Job{repJob}
+
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillRep()).To(Succeed())
+			Expect(args.Certs["rep_ca.crt"].Source).To(Equal(Source{Block: "job 0", Path: "/jobs/0/properties/diego/rep/ca_cert"}))
+			Expect(args.Sources["RepRequireTls"].Path).To(Equal("/jobs/0/properties/diego/rep/require_tls"))
+		})
+
+		It("records defaults", func() {
+			args, err := NewInstallerArguments(&manifest, "")
+			Expect(err).To(BeNil())
+
+			Expect(args.FillZone()).To(Succeed())
+			Expect(args.Sources["Zone"]).To(Equal(Source{Block: "default"}))
+			Expect(args.Sources["Zone"].String()).To(Equal("default"))
+		})
+	})
 })
@@ -1,6 +1,11 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type Release struct {
 	Name    string `json:"name"`
@@ -22,36 +27,125 @@ type Manifest struct {
 	InstanceGroups []Job       `yaml:"instance_groups"`
 }
 
-func (m *Manifest) FirstRepJob() (*Job, error) {
-	jobs := m.Jobs
-	if len(jobs) == 0 {
-		// 2.0 Manifest
-		jobs = m.InstanceGroups
+// jobs returns the manifest's jobs or, for 2.0 manifests, its instance
+// groups, and what they are called.
+func (m *Manifest) jobs() ([]Job, string) {
+	if len(m.Jobs) == 0 {
+		return m.InstanceGroups, "instance group"
 	}
+	return m.Jobs, "job"
+}
+
+// ErrRepJob is returned by RepJob when it cannot tell which job is the
+// Windows cell. RepJobs names every job with diego.rep properties or a rep
+// job.
+type ErrRepJob struct {
+	Kind          string
+	InstanceGroup string
+	RepJobs       []string
+}
+
+func (e ErrRepJob) Error() string {
+	switch {
+	case e.InstanceGroup != "":
+		return fmt.Sprintf("no %s named %s has diego.rep properties", e.Kind, e.InstanceGroup)
+	case len(e.RepJobs) == 0:
+		return "no rep job found"
+	default:
+		return fmt.Sprintf("%d %ss have diego.rep properties and the Windows cell cannot be told apart from the others", len(e.RepJobs), e.Kind)
+	}
+}
+
+func hasRep(properties *Properties) bool {
+	return properties != nil && properties.Diego != nil && properties.Diego.Rep != nil
+}
+
+// RepJob returns the job named instanceGroup, which must have diego.rep
+// properties or, in a BOSH 2 manifest, a rep job. When instanceGroup is
+// empty it returns the only job with diego.rep properties or, if there are
+// several, the only one whose name or stack is a Windows one.
+func (m *Manifest) RepJob(instanceGroup string) (*Job, error) {
+	jobs, kind := m.jobs()
 
-	for _, job := range jobs {
-		if job.Properties != nil && job.Properties.Diego != nil && job.Properties.Diego.Rep != nil {
-			return &job, nil
+	var repJobs, windowsJobs []*Job
+	var names []string
+	for i := range jobs {
+		job := &jobs[i]
+		if !job.hasJob(RepJobName) && job.FindProperties(hasRep, RepJobName) == nil {
+			continue
+		}
+		if instanceGroup != "" && job.Name == instanceGroup {
+			return job, nil
+		}
+		repJobs = append(repJobs, job)
+		if job.Name != "" {
+			names = append(names, job.Name)
+		} else {
+			names = append(names, strconv.Itoa(i))
 		}
+		if isWindowsJob(job) {
+			windowsJobs = append(windowsJobs, job)
+		}
+	}
+
+	switch {
+	case instanceGroup != "":
+	case len(repJobs) == 1:
+		return repJobs[0], nil
+	case len(windowsJobs) == 1:
+		return windowsJobs[0], nil
 	}
-	return nil, errors.New("no rep job found")
+	return nil, ErrRepJob{Kind: kind, InstanceGroup: instanceGroup, RepJobs: names}
 }
 
-func (m *Manifest) FirstConsulJob() (*Job, error) {
-	jobs := m.Jobs
-	if len(jobs) == 0 {
-		// 2.0 Manifest
-		jobs = m.InstanceGroups
+func isWindowsJob(job *Job) bool {
+	if strings.Contains(strings.ToLower(job.Name), "windows") {
+		return true
+	}
+	return job.FindProperties(hasWindowsStack, RepJobName) != nil
+}
+
+func hasWindowsStack(properties *Properties) bool {
+	return hasRep(properties) && (IsKnownStack(properties.Diego.Rep.Stack) || hasWindowsRootfs(properties))
+}
+
+func hasWindowsRootfs(properties *Properties) bool {
+	return windowsRootfs(properties) >= 0
+}
+
+// windowsRootfs returns the index of the first Windows stack in
+// diego.rep.preloaded_rootfses, or -1 if there is none.
+func windowsRootfs(properties *Properties) int {
+	if !hasRep(properties) {
+		return -1
+	}
+	for i, rootfs := range properties.Diego.Rep.PreloadedRootfses {
+		if IsKnownStack(strings.SplitN(rootfs, ":", 2)[0]) {
+			return i
+		}
 	}
+	return -1
+}
 
-	for _, job := range jobs {
-		if job.Properties != nil && job.Properties.Consul != nil && job.Properties.Consul.CACert != "" {
-			return &job, nil
+func (m *Manifest) FirstConsulJob() (*Job, error) {
+	jobs, _ := m.jobs()
+	for i := range jobs {
+		job := &jobs[i]
+		if job.FindProperties(hasConsulCA, ConsulAgentJobName) != nil {
+			return job, nil
 		}
 	}
 	return nil, errors.New("no consul job found")
 }
 
+func hasConsul(properties *Properties) bool {
+	return properties != nil && properties.Consul != nil
+}
+
+func hasConsulCA(properties *Properties) bool {
+	return hasConsul(properties) && properties.Consul.CACert != ""
+}
+
 type ConsulProperties struct {
 	RequireSSL  *string  `yaml:"require_ssl"`
 	CACert      string   `yaml:"ca_cert"`
@@ -74,24 +168,42 @@ type BBSProperties struct {
 }
 
 type Rep struct {
-	Zone       string         `yaml:"zone"`
-	BBS        *BBSProperties `yaml:"bbs"`
-	RequireTls *bool          `yaml:"require_tls"`
-	CACert     string         `yaml:"ca_cert"`
-	ServerCert string         `yaml:"server_cert"`
-	ServerKey  string         `yaml:"server_key"`
+	Zone              string         `yaml:"zone"`
+	Stack             string         `yaml:"stack"`
+	PreloadedRootfses []string       `yaml:"preloaded_rootfses"`
+	BBS               *BBSProperties `yaml:"bbs"`
+	RequireTls        *bool          `yaml:"require_tls"`
+	CACert            string         `yaml:"ca_cert"`
+	ServerCert        string         `yaml:"server_cert"`
+	ServerKey         string         `yaml:"server_key"`
+}
+
+type LocketProperties struct {
+	ApiLocation string `yaml:"api_location"`
+	CACert      string `yaml:"ca_cert"`
+	ClientCert  string `yaml:"client_cert"`
+	ClientKey   string `yaml:"client_key"`
 }
 
 type DiegoProperties struct {
-	Rep *Rep `yaml:"rep"`
+	Rep    *Rep              `yaml:"rep"`
+	Locket *LocketProperties `yaml:"locket"`
 }
 
 type LoggregatorProperties struct {
 	Etcd struct {
-		Machines []string `yaml:"machines"`
+		Machines   []string `yaml:"machines"`
+		Port       int      `yaml:"port"`
+		RequireSSL *bool    `yaml:"require_ssl"`
+		CACert     string   `yaml:"ca_cert"`
 	} `yaml:"etcd"`
 	Tls Tls `yaml:"tls"`
 }
+
+type EtcdProperties struct {
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+}
 type Tls struct {
 	CA         string    `yaml:"ca"`
 	CACert     string    `yaml:"ca_cert"`
@@ -100,6 +212,7 @@ type Tls struct {
 	Cert       string    `yaml:"cert"`
 	Key        string    `yaml:"key"`
 	Metron     MetronTls `yaml:"metron"`
+	Agent      MetronTls `yaml:"agent"`
 }
 
 type MetronTls struct {
@@ -124,15 +237,89 @@ type SyslogProperties struct {
 
 type Properties struct {
 	Consul              *ConsulProperties      `yaml:"consul"`
+	Etcd                *EtcdProperties        `yaml:"etcd"`
 	Diego               *DiegoProperties       `yaml:"diego"`
 	Loggregator         *LoggregatorProperties `yaml:"loggregator"`
 	MetronEndpoint      *MetronEndpoint        `yaml:"metron_endpoint"`
 	LoggregatorEndpoint *MetronEndpoint        `yaml:"loggregator_endpoint"`
 	MetronAgent         *MetronAgent           `yaml:"metron_agent"`
 	Syslog              *SyslogProperties      `yaml:"syslog_daemon_config"`
+	// GrpcPort is the loggregator_agent's v2 API port.
+	GrpcPort int `yaml:"grpc_port"`
 }
 
 type Job struct {
 	Name       string      `yaml:"name"`
+	Azs        []string    `yaml:"azs"`
 	Properties *Properties `yaml:"properties"`
+	// Jobs are the jobs of a BOSH 2 instance group, which carry their own
+	// properties.
+	Jobs []InstanceGroupJob `yaml:"jobs"`
+}
+
+type InstanceGroupJob struct {
+	Name       string      `yaml:"name"`
+	Release    string      `yaml:"release"`
+	Properties *Properties `yaml:"properties"`
+}
+
+// The names of the BOSH 2 jobs whose properties the installer reads.
+const (
+	RepJobName              = "rep"
+	ConsulAgentJobName      = "consul_agent"
+	MetronAgentJobName      = "metron_agent"
+	LoggregatorAgentJobName = "loggregator_agent"
+)
+
+// FindProperties returns the first properties that has accepts, looking in
+// the properties of the named jobs of the instance group in order and then
+// in the instance group's own properties. It returns nil if none of them
+// has the property.
+func (j *Job) FindProperties(has func(*Properties) bool, names ...string) *Properties {
+	for _, name := range names {
+		for _, job := range j.Jobs {
+			if job.Name == name && has(job.Properties) {
+				return job.Properties
+			}
+		}
+	}
+	if has(j.Properties) {
+		return j.Properties
+	}
+	return nil
+}
+
+// hasJob reports whether the instance group has a job named name.
+func (j *Job) hasJob(name string) bool {
+	for _, job := range j.Jobs {
+		if job.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type CertKind int
+
+const (
+	CACert CertKind = iota
+	Certificate
+	PrivateKey
+	Secret
+)
+
+// Cert is a file written alongside the install script. Kind tells callers
+// how the contents should be handled, e.g. private keys and secrets must not
+// be readable by other users. Certs in the same Group (bbs, rep, ...) form a
+// CA, certificate and private key set. Source is the property the contents
+// were read from.
+type Cert struct {
+	Group    string
+	Contents string
+	Kind     CertKind
+	Source   Source
+}
+
+func (c Cert) IsSecret() bool {
+	return c.Kind == PrivateKey || c.Kind == Secret
 }
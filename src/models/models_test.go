@@ -0,0 +1,149 @@
+package models_test
+
+import (
+	. "models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manifest", func() {
+	Describe("RepJob", func() {
+		var manifest Manifest
+
+		repJob := func(name, stack string) Job {
+			return Job{
+				Name: name,
+				Properties: &Properties{
+					Diego: &DiegoProperties{
+						Rep: &Rep{Stack: stack},
+					},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			manifest = Manifest{
+				InstanceGroups: []Job{
+					{Name: "database", Properties: &Properties{}},
+					repJob("cell", "cflinuxfs2"),
+					repJob("windows_cell", ""),
+				},
+			}
+		})
+
+		It("returns the only job with rep properties", func() {
+			manifest.InstanceGroups = manifest.InstanceGroups[:2]
+
+			job, err := manifest.RepJob("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Name).To(Equal("cell"))
+		})
+
+		It("returns a pointer into the manifest", func() {
+			job, err := manifest.RepJob("cell")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job).To(BeIdenticalTo(&manifest.InstanceGroups[1]))
+		})
+
+		It("prefers the job whose name is a Windows one", func() {
+			job, err := manifest.RepJob("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Name).To(Equal("windows_cell"))
+		})
+
+		It("prefers the job whose stack is a Windows one", func() {
+			manifest.InstanceGroups[2] = repJob("cell_z2", "")
+			manifest.InstanceGroups[2].Properties.Diego.Rep.PreloadedRootfses = []string{"windows2016:oci:///C:/rootfs"}
+
+			job, err := manifest.RepJob("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Name).To(Equal("cell_z2"))
+		})
+
+		It("returns the job named by instanceGroup", func() {
+			job, err := manifest.RepJob("cell")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Name).To(Equal("cell"))
+		})
+
+		It("lists the rep jobs when instanceGroup has no rep properties", func() {
+			_, err := manifest.RepJob("database")
+			Expect(err).To(Equal(ErrRepJob{
+				Kind:          "instance group",
+				InstanceGroup: "database",
+				RepJobs:       []string{"cell", "windows_cell"},
+			}))
+			Expect(err.Error()).To(Equal("no instance group named database has diego.rep properties"))
+		})
+
+		It("lists the rep jobs when none of them is clearly the Windows cell", func() {
+			manifest.InstanceGroups[2] = repJob("cell_z2", "")
+
+			_, err := manifest.RepJob("")
+			Expect(err).To(Equal(ErrRepJob{
+				Kind:    "instance group",
+				RepJobs: []string{"cell", "cell_z2"},
+			}))
+		})
+
+		It("finds instance groups with a rep job", func() {
+			manifest.InstanceGroups[2] = Job{
+				Name: "cell_z2",
+				Jobs: []InstanceGroupJob{
+					{Name: "rep", Release: "diego", Properties: &Properties{
+						Diego: &DiegoProperties{Rep: &Rep{Stack: "windows2016"}},
+					}},
+				},
+			}
+
+			job, err := manifest.RepJob("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Name).To(Equal("cell_z2"))
+		})
+
+		It("identifies unnamed jobs by index", func() {
+			manifest = Manifest{
+				Jobs: []Job{repJob("", ""), repJob("", "")},
+			}
+
+			_, err := manifest.RepJob("")
+			Expect(err).To(Equal(ErrRepJob{Kind: "job", RepJobs: []string{"0", "1"}}))
+		})
+	})
+
+	Describe("Job.FindProperties", func() {
+		var job Job
+
+		hasSyslog := func(properties *Properties) bool {
+			return properties != nil && properties.Syslog != nil
+		}
+
+		BeforeEach(func() {
+			job = Job{
+				Properties: &Properties{Syslog: &SyslogProperties{}},
+				Jobs: []InstanceGroupJob{
+					{Name: "consul_agent"},
+					{Name: "metron_agent", Properties: &Properties{Syslog: &SyslogProperties{}}},
+					{Name: "loggregator_agent", Properties: &Properties{Syslog: &SyslogProperties{}}},
+					{Name: "rep", Properties: &Properties{}},
+				},
+			}
+		})
+
+		It("returns the properties of the first named job that has the property", func() {
+			Expect(job.FindProperties(hasSyslog, "loggregator_agent", "metron_agent")).To(BeIdenticalTo(job.Jobs[2].Properties))
+			Expect(job.FindProperties(hasSyslog, "consul_agent", "metron_agent")).To(BeIdenticalTo(job.Jobs[1].Properties))
+		})
+
+		It("falls back to the instance group's properties", func() {
+			Expect(job.FindProperties(hasSyslog, "consul_agent")).To(BeIdenticalTo(job.Properties))
+			Expect(job.FindProperties(hasSyslog, "rep")).To(BeIdenticalTo(job.Properties))
+		})
+
+		It("returns nil when nothing has the property", func() {
+			job.Properties = nil
+			Expect(job.FindProperties(hasSyslog, "rep")).To(BeNil())
+		})
+	})
+})
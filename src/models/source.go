@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source records where a field of InstallerArguments was read from.
+type Source struct {
+	// Block is the part of the manifest that supplied the value, e.g.
+	// "job cell_z1", "instance group windows_cell", "instance group
+	// windows_cell job rep" or "global properties".
+	// Values the manifest does not set have the Block "default".
+	Block string
+	// Path is the property's path in the manifest, in the syntax used by
+	// ops files, e.g. /jobs/name=cell_z1/properties/diego/rep/zone.
+	Path string
+}
+
+func (s Source) String() string {
+	if s.Path == "" {
+		return s.Block
+	}
+	return s.Block + " " + s.Path
+}
+
+var defaultSource = Source{Block: "default"}
+
+// setCert adds cert to a.Certs, recording that its contents were read from
+// property of properties, as for setSource.
+func (a *InstallerArguments) setCert(filename string, cert Cert, properties *Properties, property string) {
+	cert.Source = a.sourceOf(properties, property)
+	a.Certs[filename] = cert
+}
+
+// setSource records that field was read from property (a dotted path such
+// as diego.rep.zone) of properties, which must belong to a job, an instance
+// group or one of its jobs, or be the global manifest properties.
+func (a *InstallerArguments) setSource(field string, properties *Properties, property string) {
+	a.Sources[field] = a.sourceOf(properties, property)
+}
+
+func (a *InstallerArguments) sourceOf(properties *Properties, property string) Source {
+	block, path := a.propertiesPath(properties)
+	return Source{
+		Block: block,
+		Path:  path + "/properties/" + strings.Replace(property, ".", "/", -1),
+	}
+}
+
+// propertiesPath returns the block name and path of the job, instance group
+// or instance group job that properties belong to.
+func (a *InstallerArguments) propertiesPath(properties *Properties) (string, string) {
+	jobs, _ := a.manifest.jobs()
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Properties == properties {
+			return a.jobPath(job)
+		}
+		for _, instanceGroupJob := range job.Jobs {
+			if instanceGroupJob.Properties == properties {
+				block, path := a.jobPath(job)
+				return block + " job " + instanceGroupJob.Name, path + "/jobs/name=" + instanceGroupJob.Name
+			}
+		}
+	}
+	return "global properties", ""
+}
+
+// jobPath returns the block name and path of job. Unnamed jobs are
+// identified by their index.
+func (a *InstallerArguments) jobPath(job *Job) (string, string) {
+	jobs, kind := a.manifest.jobs()
+	key := "jobs"
+	if kind == "instance group" {
+		key = "instance_groups"
+	}
+
+	if job.Name != "" {
+		return kind + " " + job.Name, "/" + key + "/name=" + job.Name
+	}
+	for i := range jobs {
+		if &jobs[i] == job {
+			return fmt.Sprintf("%s %d", kind, i), fmt.Sprintf("/%s/%d", key, i)
+		}
+	}
+	return kind, "/" + key
+}
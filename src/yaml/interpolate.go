@@ -0,0 +1,96 @@
+package yaml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var placeholderRegexp = regexp.MustCompile(`\(\(\s*([^()\s]+)\s*\)\)`)
+
+// ErrUnresolvedVariables lists the ((placeholders)) that were not found in
+// the variables passed to Interpolate.
+type ErrUnresolvedVariables struct {
+	Names []string
+}
+
+func (e ErrUnresolvedVariables) Error() string {
+	return "unresolved variables: " + strings.Join(e.Names, ", ")
+}
+
+// Interpolate replaces BOSH style ((name)) placeholders in document with
+// values from vars. Dotted names such as ((bbs_client.private_key)) look up
+// nested keys, which is how certificate variables are stored.
+func Interpolate(document []byte, vars map[interface{}]interface{}) ([]byte, error) {
+	var tree interface{}
+	err := yaml.Unmarshal(document, &tree)
+	if err != nil {
+		return nil, err
+	}
+
+	unresolved := map[string]bool{}
+	tree = interpolate(tree, vars, unresolved)
+
+	if len(unresolved) > 0 {
+		names := []string{}
+		for name := range unresolved {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, ErrUnresolvedVariables{Names: names}
+	}
+
+	return yaml.Marshal(tree)
+}
+
+func interpolate(node interface{}, vars map[interface{}]interface{}, unresolved map[string]bool) interface{} {
+	switch typed := node.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range typed {
+			typed[key] = interpolate(value, vars, unresolved)
+		}
+	case []interface{}:
+		for i, value := range typed {
+			typed[i] = interpolate(value, vars, unresolved)
+		}
+	case string:
+		// a value that is only a placeholder keeps the variable's type
+		if match := placeholderRegexp.FindStringSubmatch(typed); match != nil && match[0] == typed {
+			value, ok := lookupVar(vars, match[1])
+			if !ok {
+				unresolved[match[1]] = true
+				return typed
+			}
+			return value
+		}
+
+		return placeholderRegexp.ReplaceAllStringFunc(typed, func(placeholder string) string {
+			name := placeholderRegexp.FindStringSubmatch(placeholder)[1]
+			value, ok := lookupVar(vars, name)
+			if !ok {
+				unresolved[name] = true
+				return placeholder
+			}
+			return fmt.Sprint(value)
+		})
+	}
+	return node
+}
+
+func lookupVar(vars map[interface{}]interface{}, name string) (interface{}, bool) {
+	var value interface{} = vars
+	for _, key := range strings.Split(strings.TrimPrefix(name, "/"), ".") {
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,85 @@
+package yaml_test
+
+import (
+	"yaml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Interpolate", func() {
+	var vars map[interface{}]interface{}
+
+	BeforeEach(func() {
+		vars = map[interface{}]interface{}{
+			"shared_secret": "secret123",
+			"port":          11111,
+			"bbs_client": map[interface{}]interface{}{
+				"certificate": "BBS_CLIENT_CERT",
+				"private_key": "BBS_CLIENT_KEY",
+				"ca":          "BBS_CA_CERT",
+			},
+		}
+	})
+
+	It("replaces placeholders with their values", func() {
+		document := `
+shared_secret: ((shared_secret))
+port: ((port))
+`
+		result, err := yaml.Interpolate([]byte(document), vars)
+		Expect(err).ToNot(HaveOccurred())
+
+		var parsed struct {
+			SharedSecret string `yaml:"shared_secret"`
+			Port         int    `yaml:"port"`
+		}
+		Expect(yaml.Unmarshal(result, &parsed)).To(Succeed())
+		Expect(parsed.SharedSecret).To(Equal("secret123"))
+		Expect(parsed.Port).To(Equal(11111))
+	})
+
+	It("looks up certificate sub-keys", func() {
+		document := `
+bbs:
+  ca_cert: ((bbs_client.ca))
+  client_cert: ((bbs_client.certificate))
+  client_key: ((bbs_client.private_key))
+`
+		result, err := yaml.Interpolate([]byte(document), vars)
+		Expect(err).ToNot(HaveOccurred())
+
+		var parsed struct {
+			BBS map[string]string `yaml:"bbs"`
+		}
+		Expect(yaml.Unmarshal(result, &parsed)).To(Succeed())
+		Expect(parsed.BBS).To(Equal(map[string]string{
+			"ca_cert":     "BBS_CA_CERT",
+			"client_cert": "BBS_CLIENT_CERT",
+			"client_key":  "BBS_CLIENT_KEY",
+		}))
+	})
+
+	It("replaces placeholders embedded in a larger string", func() {
+		document := `address: logs.((shared_secret)).com:((port))`
+		result, err := yaml.Interpolate([]byte(document), vars)
+		Expect(err).ToNot(HaveOccurred())
+
+		var parsed map[string]string
+		Expect(yaml.Unmarshal(result, &parsed)).To(Succeed())
+		Expect(parsed["address"]).To(Equal("logs.secret123.com:11111"))
+	})
+
+	It("returns every unresolved variable", func() {
+		document := `
+items:
+- ((missing_b))
+- ((missing_a.certificate))
+- ((bbs_client.unknown))
+`
+		_, err := yaml.Interpolate([]byte(document), vars)
+		Expect(err).To(Equal(yaml.ErrUnresolvedVariables{
+			Names: []string{"bbs_client.unknown", "missing_a.certificate", "missing_b"},
+		}))
+	})
+})
@@ -0,0 +1,281 @@
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type operation struct {
+	Type  string      `yaml:"type"`
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+}
+
+const (
+	keyToken = iota
+	indexToken
+	afterLastIndexToken
+	matchingIndexToken
+)
+
+type pathToken struct {
+	kind     int
+	segment  string
+	key      string
+	index    int
+	value    string
+	optional bool
+}
+
+// ApplyOps applies a BOSH ops file to document. Only the replace and remove
+// operations are supported, with the path syntax used by the bosh CLI:
+// map keys, array indexes, "-" to append, "name=value" selectors and "?"
+// to mark the remainder of a path as optional.
+func ApplyOps(document []byte, opsFile []byte) ([]byte, error) {
+	var tree interface{}
+	err := yaml.Unmarshal(document, &tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []operation
+	err = yaml.Unmarshal(opsFile, &ops)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		tokens, err := parsePath(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation [%d] %s %s: %s", i, op.Type, op.Path, err)
+		}
+
+		switch op.Type {
+		case "replace":
+			tree, err = replaceAt(tree, tokens, 0, op.Value)
+		case "remove":
+			tree, err = removeAt(tree, tokens, 0)
+		default:
+			err = fmt.Errorf("unknown operation type %q", op.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation [%d] %s %s: %s", i, op.Type, op.Path, err)
+		}
+	}
+
+	return yaml.Marshal(tree)
+}
+
+func parsePath(path string) ([]pathToken, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("expected path to start with '/'")
+	}
+	if path == "/" {
+		return nil, nil
+	}
+
+	tokens := []pathToken{}
+	optional := false
+	for _, segment := range strings.Split(path[1:], "/") {
+		token := pathToken{segment: segment}
+		if strings.HasSuffix(segment, "?") {
+			optional = true
+			segment = strings.TrimSuffix(segment, "?")
+		}
+		token.optional = optional
+		segment = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+
+		if segment == "-" {
+			token.kind = afterLastIndexToken
+		} else if index, err := strconv.Atoi(segment); err == nil {
+			token.kind = indexToken
+			token.index = index
+		} else if parts := strings.SplitN(segment, "=", 2); len(parts) == 2 {
+			token.kind = matchingIndexToken
+			token.key = parts[0]
+			token.value = parts[1]
+		} else {
+			token.kind = keyToken
+			token.key = segment
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func pathTo(tokens []pathToken, i int) string {
+	segments := []string{}
+	for _, token := range tokens[:i+1] {
+		segments = append(segments, token.segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func replaceAt(node interface{}, tokens []pathToken, i int, value interface{}) (interface{}, error) {
+	if i == len(tokens) {
+		return value, nil
+	}
+	token := tokens[i]
+	isLast := i == len(tokens)-1
+
+	if token.kind == keyToken {
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			if node != nil || !token.optional {
+				return nil, fmt.Errorf("expected to find a map at path '%s' but found %T", pathTo(tokens, i), node)
+			}
+			m = map[interface{}]interface{}{}
+		}
+		child, found := m[token.key]
+		if !found && !token.optional {
+			return nil, fmt.Errorf("expected to find a map key '%s' for path '%s'", token.key, pathTo(tokens, i))
+		}
+		child, err := replaceAt(child, tokens, i+1, value)
+		if err != nil {
+			return nil, err
+		}
+		m[token.key] = child
+		return m, nil
+	}
+
+	array, ok := node.([]interface{})
+	if !ok {
+		if node != nil || !token.optional {
+			return nil, fmt.Errorf("expected to find an array at path '%s' but found %T", pathTo(tokens, i), node)
+		}
+		array = []interface{}{}
+	}
+
+	switch token.kind {
+	case afterLastIndexToken:
+		if !isLast {
+			return nil, fmt.Errorf("expected not to find any path segments after '-' in path '%s'", pathTo(tokens, i))
+		}
+		return append(array, value), nil
+
+	case indexToken:
+		index, err := arrayIndex(array, token, tokens, i)
+		if err != nil {
+			return nil, err
+		}
+		array[index], err = replaceAt(array[index], tokens, i+1, value)
+		return array, err
+
+	default:
+		matches := matchingIndexes(array, token)
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("expected to find exactly one matching array item for path '%s' but found %d", pathTo(tokens, i), len(matches))
+		}
+		if len(matches) == 0 {
+			if !token.optional {
+				return nil, fmt.Errorf("expected to find exactly one matching array item for path '%s' but found 0", pathTo(tokens, i))
+			}
+			if isLast {
+				return append(array, value), nil
+			}
+			array = append(array, map[interface{}]interface{}{token.key: token.value})
+			matches = []int{len(array) - 1}
+		}
+		var err error
+		array[matches[0]], err = replaceAt(array[matches[0]], tokens, i+1, value)
+		return array, err
+	}
+}
+
+func removeAt(node interface{}, tokens []pathToken, i int) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("cannot remove the root of the document")
+	}
+	token := tokens[i]
+	isLast := i == len(tokens)-1
+
+	if token.kind == keyToken {
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			if node == nil && token.optional {
+				return node, nil
+			}
+			return nil, fmt.Errorf("expected to find a map at path '%s' but found %T", pathTo(tokens, i), node)
+		}
+		child, found := m[token.key]
+		if !found {
+			if token.optional {
+				return m, nil
+			}
+			return nil, fmt.Errorf("expected to find a map key '%s' for path '%s'", token.key, pathTo(tokens, i))
+		}
+		if isLast {
+			delete(m, token.key)
+			return m, nil
+		}
+		child, err := removeAt(child, tokens, i+1)
+		if err != nil {
+			return nil, err
+		}
+		m[token.key] = child
+		return m, nil
+	}
+
+	array, ok := node.([]interface{})
+	if !ok {
+		if node == nil && token.optional {
+			return node, nil
+		}
+		return nil, fmt.Errorf("expected to find an array at path '%s' but found %T", pathTo(tokens, i), node)
+	}
+
+	var index int
+	switch token.kind {
+	case afterLastIndexToken:
+		return nil, fmt.Errorf("cannot remove '-' in path '%s'", pathTo(tokens, i))
+
+	case indexToken:
+		var err error
+		index, err = arrayIndex(array, token, tokens, i)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		matches := matchingIndexes(array, token)
+		if len(matches) == 0 && token.optional {
+			return array, nil
+		}
+		if len(matches) != 1 {
+			return nil, fmt.Errorf("expected to find exactly one matching array item for path '%s' but found %d", pathTo(tokens, i), len(matches))
+		}
+		index = matches[0]
+	}
+
+	if isLast {
+		return append(array[:index], array[index+1:]...), nil
+	}
+	var err error
+	array[index], err = removeAt(array[index], tokens, i+1)
+	return array, err
+}
+
+func arrayIndex(array []interface{}, token pathToken, tokens []pathToken, i int) (int, error) {
+	index := token.index
+	if index < 0 {
+		index = len(array) + index
+	}
+	if index < 0 || index >= len(array) {
+		return 0, fmt.Errorf("expected to find array index %d but found array of length %d for path '%s'", token.index, len(array), pathTo(tokens, i))
+	}
+	return index, nil
+}
+
+func matchingIndexes(array []interface{}, token pathToken) []int {
+	matches := []int{}
+	for i, item := range array {
+		m, ok := item.(map[interface{}]interface{})
+		if ok && fmt.Sprint(m[token.key]) == token.value {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
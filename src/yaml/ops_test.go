@@ -0,0 +1,104 @@
+package yaml_test
+
+import (
+	"yaml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApplyOps", func() {
+	const document = `
+instance_groups:
+- name: cell
+  instances: 2
+  azs: [z1]
+- name: windows_cell
+  instances: 1
+  azs: [z1, z2]
+properties:
+  syslog_daemon_config:
+    address: logs.example.com
+`
+
+	apply := func(ops string) map[interface{}]interface{} {
+		result, err := yaml.ApplyOps([]byte(document), []byte(ops))
+		Expect(err).ToNot(HaveOccurred())
+
+		parsed := map[interface{}]interface{}{}
+		Expect(yaml.Unmarshal(result, &parsed)).To(Succeed())
+		return parsed
+	}
+
+	It("replaces map keys", func() {
+		parsed := apply(`
+- type: replace
+  path: /properties/syslog_daemon_config/address
+  value: logs2.test.com
+`)
+		Expect(parsed["properties"]).To(Equal(map[interface{}]interface{}{
+			"syslog_daemon_config": map[interface{}]interface{}{"address": "logs2.test.com"},
+		}))
+	})
+
+	It("selects array items by name and index", func() {
+		parsed := apply(`
+- type: replace
+  path: /instance_groups/name=windows_cell/instances
+  value: 3
+- type: replace
+  path: /instance_groups/0/azs/-
+  value: z3
+`)
+		groups := parsed["instance_groups"].([]interface{})
+		Expect(groups[0].(map[interface{}]interface{})["azs"]).To(Equal([]interface{}{"z1", "z3"}))
+		Expect(groups[1].(map[interface{}]interface{})["instances"]).To(Equal(3))
+	})
+
+	It("creates optional path segments", func() {
+		parsed := apply(`
+- type: replace
+  path: /properties/diego?/rep/zone
+  value: windows
+- type: replace
+  path: /instance_groups/name=extra?/instances
+  value: 1
+`)
+		Expect(parsed["properties"].(map[interface{}]interface{})["diego"]).To(Equal(map[interface{}]interface{}{
+			"rep": map[interface{}]interface{}{"zone": "windows"},
+		}))
+		groups := parsed["instance_groups"].([]interface{})
+		Expect(groups).To(HaveLen(3))
+		Expect(groups[2]).To(Equal(map[interface{}]interface{}{"name": "extra", "instances": 1}))
+	})
+
+	It("removes keys and array items", func() {
+		parsed := apply(`
+- type: remove
+  path: /instance_groups/name=cell
+- type: remove
+  path: /properties/syslog_daemon_config
+- type: remove
+  path: /properties/missing?
+`)
+		Expect(parsed["instance_groups"]).To(HaveLen(1))
+		Expect(parsed["properties"]).To(BeEmpty())
+	})
+
+	It("returns an error when a path does not resolve", func() {
+		_, err := yaml.ApplyOps([]byte(document), []byte(`
+- type: replace
+  path: /properties/diego/rep/zone
+  value: windows
+`))
+		Expect(err).To(MatchError("operation [0] replace /properties/diego/rep/zone: expected to find a map key 'diego' for path '/properties/diego'"))
+	})
+
+	It("returns an error when a selector does not match", func() {
+		_, err := yaml.ApplyOps([]byte(document), []byte(`
+- type: remove
+  path: /instance_groups/name=linux_cell
+`))
+		Expect(err).To(MatchError("operation [0] remove /instance_groups/name=linux_cell: expected to find exactly one matching array item for path '/instance_groups/name=linux_cell' but found 0"))
+	})
+})
@@ -8,3 +8,7 @@ func Unmarshal(ba []byte, result interface{}) error {
 	// decoder := candiedyaml.NewDecoder(buf)
 	// return decoder.Decode(result)
 }
+
+func Marshal(in interface{}) ([]byte, error) {
+	return yaml.Marshal(in)
+}